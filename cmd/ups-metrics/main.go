@@ -3,48 +3,151 @@ package main
 import (
 	"context"
 	"github.com/alexwbaule/ups-metrics/internal/application"
-	"github.com/alexwbaule/ups-metrics/internal/application/config"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/battery"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/command"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/energy"
 	"github.com/alexwbaule/ups-metrics/internal/domain/service/metric"
 	"github.com/alexwbaule/ups-metrics/internal/domain/service/notification"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/outage"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/server/apcupsd"
+	"github.com/alexwbaule/ups-metrics/internal/resource/server/api"
+	"github.com/alexwbaule/ups-metrics/internal/resource/server/nut"
+	"github.com/alexwbaule/ups-metrics/internal/resource/server/snmp"
 	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/sync/errgroup"
 	"net/http"
+	"os"
 )
 
 func main() {
 	app := application.NewApplication()
 
-	app.Run(func(ctx context.Context) error {
-		app.Log.Infof("Device Interval: %+v", app.Config.GetInterval())
+	if len(os.Args) > 1 {
+		subcommand(app, os.Args[1], os.Args[2:])
+		return
+	}
 
+	app.Run(func(ctx context.Context) error {
 		app.Log.SetLevel(app.Config.GetLogLevel())
 
-		sms := smsups.MewSMSUPS(app)
-		err := sms.Login(ctx, 1)
+		g, ctx := errgroup.WithContext(ctx)
+
+		events := history.NewHistory()
+
+		notificationSink, err := notification.NewSink(app, events)
 		if err != nil {
 			return err
 		}
-		metrics := metric.NewMetric(app, sms)
-		notif := notification.NewGetNotification(app, sms)
 
-		g, ctx := errgroup.WithContext(ctx)
+		store := latest.NewStore()
+		commander := command.NewCommander(app, notificationSink)
 
-		g.Go(func() error {
-			return metrics.Run(ctx)
-		})
+		var meter *energy.Meter
+		if app.Config.GetEnergyConfig().Enabled {
+			meter, err = energy.NewMeter(app)
+			if err != nil {
+				return err
+			}
+		}
 
-		g.Go(func() error {
-			return notif.Run(ctx)
-		})
+		var estimator *battery.Estimator
+		if app.Config.GetBatteryRuntimeConfig().Enabled {
+			estimator, err = battery.NewEstimator(app)
+			if err != nil {
+				return err
+			}
+		}
 
+		var tracker *outage.Tracker
+		if app.Config.GetOutagesConfig().Enabled {
+			tracker, err = outage.NewTracker(app)
+			if err != nil {
+				return err
+			}
+			notificationSink.Add("outages", tracker)
+		}
+
+		metricWriter, err := metric.NewWriter(app, notificationSink, store, meter, estimator, tracker)
+		if err != nil {
+			return err
+		}
 		g.Go(func() error {
-			<-ctx.Done()
-			return config.SaveLastIdConfig(notif.LastId())
+			return metricWriter.Run(ctx)
 		})
 
+		if app.Config.GetServersConfig().Nut.Enabled {
+			nutServer := nut.NewServer(app, store, commander, estimator)
+			g.Go(func() error {
+				return nutServer.Run(ctx)
+			})
+		}
+
+		if app.Config.GetServersConfig().Apcupsd.Enabled {
+			apcupsdServer := apcupsd.NewServer(app, store, events, estimator)
+			g.Go(func() error {
+				return apcupsdServer.Run(ctx)
+			})
+		}
+
+		if app.Config.GetServersConfig().Snmp.Enabled {
+			snmpServer, err := snmp.NewServer(app, store, estimator)
+			if err != nil {
+				return err
+			}
+			notificationSink.Add("snmp", snmpServer)
+			g.Go(func() error {
+				return snmpServer.Run(ctx)
+			})
+		}
+
+		for _, d := range app.Config.GetDevices() {
+			app.Log.Infof("Device %s (%s) Interval: %+v", d.Name, d.Address, d.Interval)
+
+			sms, err := smsups.MewSMSUPS(app, d)
+			if err != nil {
+				return err
+			}
+			err = sms.Login(ctx)
+			if err != nil {
+				return err
+			}
+			commander.Add(sms)
+
+			metrics := metric.NewMetric(app, sms, metricWriter)
+			notif, err := notification.NewGetNotification(app, d, sms, notificationSink)
+			if err != nil {
+				return err
+			}
+
+			g.Go(func() error {
+				return metrics.Run(ctx)
+			})
+
+			g.Go(func() error {
+				return notif.Run(ctx)
+			})
+		}
+
+		if app.Config.GetServersConfig().Api.Enabled {
+			apiHandler, err := api.NewHandler(app)
+			if err != nil {
+				return err
+			}
+			apiHandler.Handle("/api/v1/commands", api.CommandHandler(commander))
+			if meter != nil {
+				apiHandler.Handle("/api/v1/energy", api.EnergyHandler(meter))
+			}
+			if tracker != nil {
+				apiHandler.Handle("/api/v1/outages", api.OutageHandler(tracker))
+			}
+			http.Handle("/api/", apiHandler)
+		}
+
 		g.Go(func() error {
-			http.Handle("/metrics", promhttp.Handler())
+			http.Handle(app.Config.GetMetricConfig().Prometheus.Path, promhttp.Handler())
 			return http.ListenAndServe(":"+app.Config.GetMetricConfig().Prometheus.Port, nil)
 		})
 		return g.Wait()
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/command"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/notification"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/outage"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// subcommand runs a one shot task instead of the collector.
+func subcommand(app *application.Application, name string, args []string) {
+	switch name {
+	case "command":
+		app.Run(func(ctx context.Context) error {
+			return runCommand(ctx, app, args)
+		})
+	case "fake-ups":
+		app.Run(func(ctx context.Context) error {
+			return runFakeUPS(ctx, app, args)
+		})
+	case "outages":
+		app.Run(func(ctx context.Context) error {
+			return runOutages(os.Stdout, app, args)
+		})
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %s\n", name)
+		os.Exit(2)
+	}
+}
+
+// runCommand sends a command to a UPS:
+//
+//	ups-metrics command <device> <command> [delay]
+func runCommand(ctx context.Context, app *application.Application, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		var names []string
+		for _, cmd := range smsups.Commands(app.Config.GetCommandsConfig().Experimental) {
+			names = append(names, string(cmd))
+		}
+		return fmt.Errorf("usage: ups-metrics command <device> <%s> [delay]", strings.Join(names, "|"))
+	}
+	cmd, err := smsups.ParseCommand(args[1])
+	if err != nil {
+		return err
+	}
+	var delay time.Duration
+	if len(args) == 3 {
+		delay, err = time.ParseDuration(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid delay: %w", err)
+		}
+	}
+
+	for _, d := range app.Config.GetDevices() {
+		if d.Name != args[0] {
+			continue
+		}
+		sink, err := notification.NewSink(app, history.NewHistory())
+		if err != nil {
+			return err
+		}
+		sms, err := smsups.MewSMSUPS(app, d)
+		if err != nil {
+			return err
+		}
+		err = sms.Login(ctx)
+		if err != nil {
+			return err
+		}
+		commander := command.NewCommander(app, sink)
+		commander.Add(sms)
+		return commander.Execute(ctx, d.Name, cmd, delay)
+	}
+	return fmt.Errorf("unknown device %s", args[0])
+}
+
+// runFakeUPS serves a fake UPS accepting the login of the first device, and
+// plays the scenario on it:
+//
+//	ups-metrics fake-ups [scenario] [listen]
+//
+// Point the device address at the listen address to collect from it.
+func runFakeUPS(ctx context.Context, app *application.Application, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("usage: ups-metrics fake-ups [%s] [listen]", strings.Join(smsupstest.ScenarioNames(), "|"))
+	}
+	scenario := "normal"
+	if len(args) > 0 {
+		scenario = args[0]
+	}
+	listen := "127.0.0.1:8443"
+	if len(args) > 1 {
+		listen = args[1]
+	}
+	if _, ok := smsupstest.Scenarios[scenario]; !ok {
+		return fmt.Errorf("unknown scenario %s, use one of %s", scenario, strings.Join(smsupstest.ScenarioNames(), ", "))
+	}
+
+	d := app.Config.GetDevices()[0]
+	fake := smsupstest.NewServer(app.Log, d.Name, d.Login.Username, d.Login.Password)
+	err := fake.Start(listen)
+	if err != nil {
+		return err
+	}
+	defer fake.Close()
+
+	err = fake.PlayNamed(ctx, scenario)
+	if err != nil {
+		return err
+	}
+	app.Log.Infof("scenario %s finished, serving until stopped", scenario)
+	<-ctx.Done()
+	return context.Canceled
+}
+
+// runOutages prints the outages kept in the state dir, with their count and
+// duration per day, for the last days (30 by default):
+//
+//	ups-metrics outages [days] [device]
+func runOutages(out io.Writer, app *application.Application, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("usage: ups-metrics outages [days] [device]")
+	}
+	days := 30
+	if len(args) > 0 {
+		var err error
+		days, err = strconv.Atoi(args[0])
+		if err != nil || days < 1 {
+			return fmt.Errorf("invalid days %q", args[0])
+		}
+	}
+	var name string
+	if len(args) > 1 {
+		name = args[1]
+	}
+
+	h, err := outage.ReadHistory(app.Config.GetStateDir())
+	if err != nil {
+		return err
+	}
+	report := h.Report(name, days, time.Now())
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tSTART\tEND\tDURATION\tMIN BATTERY\tMAX LOAD")
+	for _, o := range report.Outages {
+		end := "on battery"
+		if o.End != nil {
+			end = o.End.Format(time.DateTime)
+		}
+		battery, load := "-", "-"
+		if o.Readings > 0 {
+			battery = fmt.Sprintf("%.0f%%", o.MinBattery)
+			load = fmt.Sprintf("%.0f%%", o.MaxLoad)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", o.Device, o.Start.Format(time.DateTime), end, seconds(o.Seconds), battery, load)
+	}
+	fmt.Fprintln(w)
+
+	var count int
+	var total float64
+	fmt.Fprintln(w, "DATE\tOUTAGES\tDURATION")
+	for _, d := range report.Days {
+		count += d.Count
+		total += d.Seconds
+		fmt.Fprintf(w, "%s\t%d\t%s\n", d.Date, d.Count, seconds(d.Seconds))
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%s\n", count, seconds(total))
+	return w.Flush()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
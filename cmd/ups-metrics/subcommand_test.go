@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunOutages(t *testing.T) {
+	_, app := smsupstest.NewApplication(t, "")
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	yaml := fmt.Sprintf(`outages:
+  - device: rack
+    start: %s
+    end: %s
+    min_battery: 62
+    max_load: 35
+    readings: 10
+  - device: other
+    start: %s
+`, start.Format(time.RFC3339), start.Add(90*time.Minute).Format(time.RFC3339), start.Format(time.RFC3339))
+	err := os.WriteFile(filepath.Join(app.Config.GetStateDir(), "outages.yaml"), []byte(yaml), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = runOutages(&out, app, []string{"2", "rack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// header, outage, blank, header, 2 days, total
+	if len(lines) != 7 {
+		t.Fatalf("printed %d lines, want 7:\n%s", len(lines), out.String())
+	}
+	outage := strings.Fields(lines[1])
+	if outage[0] != "rack" || !slices.Contains(outage, "1h30m0s") || !slices.Contains(outage, "62%") || !slices.Contains(outage, "35%") {
+		t.Errorf("outage printed as %q", lines[1])
+	}
+	if total := strings.Fields(lines[6]); total[0] != "TOTAL" || total[1] != "1" || total[2] != "1h30m0s" {
+		t.Errorf("total printed as %q", lines[6])
+	}
+
+	for _, args := range [][]string{{"0"}, {"week"}, {"1", "rack", "extra"}} {
+		err = runOutages(&out, app, args)
+		if err == nil {
+			t.Errorf("no error for %q", args)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 	"github.com/spf13/viper"
+	"path/filepath"
 	"time"
 )
 
@@ -20,6 +21,27 @@ var (
 	defaultRetryCount            = 2                    // Reduzido de 3 para 2 (total 2 tentativas)
 	defaultRetryWaitCount        = 1 * time.Second      // Aumentado de 100ms
 	defaultRetryMaxWaitTime      = 3 * time.Second      // Aumentado de 500ms
+	defaultTokenTTL              = 30 * time.Minute
+	defaultPrometheusMaxAge      = 1 * time.Minute
+	defaultPrometheusPath        = "/metrics"
+	defaultInfluxVersion         = 1
+	defaultInfluxPrecision       = "ns"
+	defaultMqttClientID          = "ups-metrics"
+	defaultMqttTopicPrefix       = "ups-metrics"
+	defaultMqttDiscoveryPrefix   = "homeassistant"
+	defaultStateDir              = "conf"
+	defaultBufferMaxSize         = int64(50 << 20)
+	defaultBufferMaxAge          = 24 * time.Hour
+	defaultShutdownTimeout       = 30 * time.Second
+	defaultLostContact           = 2 * time.Minute
+	defaultNutListen             = ":3493"
+	defaultApcupsdListen         = ":3551"
+	defaultSnmpListen            = ":161"
+	defaultLowBattery            = 20.0
+	defaultPowerFactor           = 0.6
+	defaultBatteryEfficiency     = 0.8
+	defaultMinDischarge          = 5.0
+	defaultOutagesMaxAge         = 365 * 24 * time.Hour
 )
 
 type Config struct {
@@ -27,14 +49,18 @@ type Config struct {
 }
 
 const defaultConfig = `conf/config.yaml`
-const defaultCountConfig = `conf/count.yaml`
 
 func NewDefaultConfig() (*Config, error) {
+	return NewConfig(defaultConfig)
+}
+
+// NewConfig reads the yaml config at file, filling in the defaults.
+func NewConfig(file string) (*Config, error) {
 	v := viper.New()
 	var config device.Config
 
 	v.SetConfigType("yaml")
-	v.SetConfigFile(defaultConfig)
+	v.SetConfigFile(file)
 	err := v.ReadInConfig()
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
@@ -44,40 +70,24 @@ func NewDefaultConfig() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshalling config file: %w", err)
 	}
 	setDefaults(&config)
+	err = setDevicesDefaults(&config)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		device: &config,
 	}, err
 }
 
-func SaveLastIdConfig(id int) error {
-	v := viper.New()
-	v.SetConfigType("yaml")
-	v.SetConfigFile(defaultCountConfig)
-	v.Set("last", id)
-	return v.WriteConfig()
-}
-
-func (c *Config) GetLastKnowId() int {
-	v := viper.New()
-	v.SetConfigType("yaml")
-	v.SetConfigFile(defaultCountConfig)
-	err := v.ReadInConfig()
-	if err != nil {
-		panic(fmt.Errorf("error reading config file: %w", err))
-	}
-	return v.GetInt("last")
-}
-
 func (c *Config) GetLogLevel() string {
 	return c.device.LogLevel
 }
-func (c *Config) GetInterval() time.Duration {
-	return c.device.Interval
-}
 
-func (c *Config) GetLogin() device.Login {
-	return c.device.Login
+// GetDevices returns every UPS to be polled. When no "devices" list is
+// configured, the single "device" block is used.
+func (c *Config) GetDevices() []device.Device {
+	return c.device.Devices
 }
 
 func (c *Config) GetMetricConfig() device.Metrics {
@@ -88,8 +98,41 @@ func (c *Config) GetGelfConfig() device.Gelf {
 	return c.device.Logs.Gelf
 }
 
-func (c *Config) GetDeviceAddress() string {
-	return c.device.Device.Address
+func (c *Config) GetNotifiersConfig() device.Notifiers {
+	return c.device.Notifiers
+}
+
+func (c *Config) GetAlertsConfig() device.Alerts {
+	return c.device.Alerts
+}
+
+func (c *Config) GetShutdownConfig() device.Shutdown {
+	return c.device.Shutdown
+}
+
+func (c *Config) GetEnergyConfig() device.Energy {
+	return c.device.Energy
+}
+
+func (c *Config) GetBatteryRuntimeConfig() device.BatteryRuntime {
+	return c.device.BatteryRuntime
+}
+
+func (c *Config) GetOutagesConfig() device.Outages {
+	return c.device.Outages
+}
+
+func (c *Config) GetCommandsConfig() device.UPSCommands {
+	return c.device.UPSCommands
+}
+
+func (c *Config) GetServersConfig() device.Servers {
+	return c.device.Servers
+}
+
+// GetStateDir returns the directory where state kept across restarts is stored.
+func (c *Config) GetStateDir() string {
+	return c.device.State.Dir
 }
 
 func (c *Config) GetHttpClient() device.HttpClient {
@@ -100,37 +143,220 @@ func setDefaults(cfg *device.Config) {
 	if cfg.Interval == 0 {
 		cfg.Interval = defaultInterval
 	}
-	if cfg.HttpClient.MaxIdleConns == 0 {
-		cfg.HttpClient.MaxIdleConns = defaultMaxIdleConns
+	if cfg.Prometheus.MaxAge == 0 {
+		cfg.Prometheus.MaxAge = defaultPrometheusMaxAge
+	}
+	if cfg.Prometheus.Path == "" {
+		cfg.Prometheus.Path = defaultPrometheusPath
+	}
+	if cfg.Influx.Version == 0 {
+		cfg.Influx.Version = defaultInfluxVersion
+	}
+	if cfg.Influx.Precision == "" {
+		cfg.Influx.Precision = defaultInfluxPrecision
+	}
+	if cfg.Influx.Bucket == "" {
+		cfg.Influx.Bucket = cfg.Influx.Database
+	}
+	if cfg.Mqtt.ClientID == "" {
+		cfg.Mqtt.ClientID = defaultMqttClientID
+	}
+	if cfg.Mqtt.TopicPrefix == "" {
+		cfg.Mqtt.TopicPrefix = defaultMqttTopicPrefix
+	}
+	if cfg.Mqtt.DiscoveryPrefix == "" {
+		cfg.Mqtt.DiscoveryPrefix = defaultMqttDiscoveryPrefix
+	}
+	if cfg.Mqtt.MaxAge == 0 {
+		cfg.Mqtt.MaxAge = cfg.Prometheus.MaxAge
+	}
+	if cfg.State.Dir == "" {
+		cfg.State.Dir = defaultStateDir
 	}
-	if cfg.HttpClient.MaxConnsPerHost == 0 {
-		cfg.HttpClient.MaxConnsPerHost = defaultMaxConnsPerHost
+	if cfg.Buffer.Path == "" {
+		cfg.Buffer.Path = filepath.Join(cfg.State.Dir, "buffer")
 	}
-	if cfg.HttpClient.MaxIdleConnsPerHost == 0 {
-		cfg.HttpClient.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if cfg.Buffer.MaxSize == 0 {
+		cfg.Buffer.MaxSize = defaultBufferMaxSize
 	}
-	if cfg.HttpClient.ResponseHeaderTimeout == 0 {
-		cfg.HttpClient.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	if cfg.Buffer.MaxAge == 0 {
+		cfg.Buffer.MaxAge = defaultBufferMaxAge
 	}
-	if cfg.HttpClient.TLSHandshakeTimeout == 0 {
-		cfg.HttpClient.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	if cfg.Shutdown.AuditLog == "" {
+		cfg.Shutdown.AuditLog = filepath.Join(cfg.State.Dir, "shutdown-audit.log")
 	}
-	if cfg.HttpClient.ExpectContinueTimeout == 0 {
-		cfg.HttpClient.ExpectContinueTimeout = defaultExpectContinueTimeout
+	if cfg.Shutdown.LostContact == 0 {
+		cfg.Shutdown.LostContact = defaultLostContact
+	}
+	for i := range cfg.Shutdown.Commands {
+		if cfg.Shutdown.Commands[i].Timeout == 0 {
+			cfg.Shutdown.Commands[i].Timeout = defaultShutdownTimeout
+		}
+	}
+	if cfg.BatteryRuntime.MinDischarge == 0 {
+		cfg.BatteryRuntime.MinDischarge = defaultMinDischarge
+	}
+	if cfg.Outages.MaxAge == 0 {
+		cfg.Outages.MaxAge = defaultOutagesMaxAge
+	}
+	if cfg.Nut.Listen == "" {
+		cfg.Nut.Listen = defaultNutListen
+	}
+	if cfg.Nut.LowBattery == 0 {
+		cfg.Nut.LowBattery = defaultLowBattery
+	}
+	if cfg.Nut.MaxAge == 0 {
+		cfg.Nut.MaxAge = cfg.Prometheus.MaxAge
+	}
+	if cfg.Apcupsd.Listen == "" {
+		cfg.Apcupsd.Listen = defaultApcupsdListen
+	}
+	if cfg.Apcupsd.LowBattery == 0 {
+		cfg.Apcupsd.LowBattery = defaultLowBattery
+	}
+	if cfg.Apcupsd.MaxAge == 0 {
+		cfg.Apcupsd.MaxAge = cfg.Prometheus.MaxAge
+	}
+	if cfg.Snmp.Listen == "" {
+		cfg.Snmp.Listen = defaultSnmpListen
+	}
+	if cfg.Snmp.LowBattery == 0 {
+		cfg.Snmp.LowBattery = defaultLowBattery
+	}
+	if cfg.Snmp.MaxAge == 0 {
+		cfg.Snmp.MaxAge = cfg.Prometheus.MaxAge
+	}
+	setHttpClientDefaults(&cfg.HttpClient)
+}
+
+func setHttpClientDefaults(cfg *device.HttpClient) {
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.MaxConnsPerHost == 0 {
+		cfg.MaxConnsPerHost = defaultMaxConnsPerHost
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if cfg.ResponseHeaderTimeout == 0 {
+		cfg.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	}
+	if cfg.TLSHandshakeTimeout == 0 {
+		cfg.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	if cfg.ExpectContinueTimeout == 0 {
+		cfg.ExpectContinueTimeout = defaultExpectContinueTimeout
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.DialKeepAlive == 0 {
+		cfg.DialKeepAlive = defaultDialKeepAlive
+	}
+	if cfg.RetryCount == 0 {
+		cfg.RetryCount = defaultRetryCount
+	}
+	if cfg.RetryWaitCount == 0 {
+		cfg.RetryWaitCount = defaultRetryWaitCount
+	}
+	if cfg.RetryMaxWaitTime == 0 {
+		cfg.RetryMaxWaitTime = defaultRetryMaxWaitTime
+	}
+}
+
+func setDevicesDefaults(cfg *device.Config) error {
+	if len(cfg.Devices) == 0 {
+		cfg.Devices = []device.Device{cfg.Device}
+	}
+	names := make(map[string]bool, len(cfg.Devices))
+
+	for i := range cfg.Devices {
+		d := &cfg.Devices[i]
+		if d.Address == "" {
+			return fmt.Errorf("device %d has no address", i)
+		}
+		if d.Name == "" {
+			d.Name = d.Address
+		}
+		if names[d.Name] {
+			return fmt.Errorf("duplicated device name %s", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.Interval == 0 {
+			d.Interval = cfg.Interval
+		}
+		if d.Login.Username == "" {
+			d.Login = cfg.Login
+		}
+		if d.Login.TokenTTL == 0 {
+			d.Login.TokenTTL = defaultTokenTTL
+		}
+		if d.Fixtures.Record != "" && d.Fixtures.Replay != "" {
+			return fmt.Errorf("device %s can not record and replay fixtures at the same time", d.Name)
+		}
+		if d.Rating.Watts == 0 && d.Rating.VA > 0 {
+			if d.Rating.PowerFactor == 0 {
+				d.Rating.PowerFactor = defaultPowerFactor
+			}
+			d.Rating.Watts = d.Rating.VA * d.Rating.PowerFactor
+		}
+		if d.Rating.Watts < 0 {
+			return fmt.Errorf("device %s has a negative rating", d.Name)
+		}
+		if d.Battery.Efficiency == 0 {
+			d.Battery.Efficiency = defaultBatteryEfficiency
+		}
+		if d.HttpClient == (device.HttpClient{}) {
+			d.HttpClient = cfg.HttpClient
+		}
+		setHttpClientDefaults(&d.HttpClient)
+	}
+	if cfg.Apcupsd.Device == "" {
+		cfg.Apcupsd.Device = cfg.Devices[0].Name
+	}
+	if !names[cfg.Apcupsd.Device] {
+		return fmt.Errorf("apcupsd server device %s is not configured", cfg.Apcupsd.Device)
+	}
+	err := validateShutdown(cfg, names)
+	if err != nil {
+		return err
+	}
+	if cfg.Snmp.Device == "" {
+		cfg.Snmp.Device = cfg.Devices[0].Name
+	}
+	if !names[cfg.Snmp.Device] {
+		return fmt.Errorf("snmp server device %s is not configured", cfg.Snmp.Device)
+	}
+	return nil
+}
+
+// validateShutdown refuses an enabled shutdown controller that could never
+// shut anything down.
+func validateShutdown(cfg *device.Config, names map[string]bool) error {
+	s := cfg.Shutdown
+	if !s.Enabled {
+		return nil
 	}
-	if cfg.HttpClient.DialTimeout == 0 {
-		cfg.HttpClient.DialTimeout = defaultDialTimeout
+	if s.BatteryLevel <= 0 && s.Runtime <= 0 && s.OnBatteryFor <= 0 {
+		return fmt.Errorf("shutdown: set at least one of battery_level, runtime or on_battery_for")
 	}
-	if cfg.HttpClient.DialKeepAlive == 0 {
-		cfg.HttpClient.DialKeepAlive = defaultDialKeepAlive
+	if s.Runtime > 0 && !cfg.BatteryRuntime.Enabled {
+		return fmt.Errorf("shutdown: runtime needs battery_runtime enabled")
 	}
-	if cfg.HttpClient.RetryCount == 0 {
-		cfg.HttpClient.RetryCount = defaultRetryCount
+	if len(s.Commands) == 0 {
+		return fmt.Errorf("shutdown: no commands configured")
 	}
-	if cfg.HttpClient.RetryWaitCount == 0 {
-		cfg.HttpClient.RetryWaitCount = defaultRetryWaitCount
+	for _, c := range s.Commands {
+		if c.Command == "" {
+			return fmt.Errorf("shutdown: command without a command name")
+		}
 	}
-	if cfg.HttpClient.RetryMaxWaitTime == 0 {
-		cfg.HttpClient.RetryMaxWaitTime = defaultRetryMaxWaitTime
+	for _, name := range s.Devices {
+		if !names[name] {
+			return fmt.Errorf("shutdown device %s is not configured", name)
+		}
 	}
+	return nil
 }
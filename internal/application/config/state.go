@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const countStateFile = `count.yaml`
+
+// countState is the layout of count.yaml. Last is the cursor written by
+// single-device versions, which polled the first configured device only.
+type countState struct {
+	Last    int            `yaml:"last,omitempty"`
+	Devices map[string]int `yaml:"devices"`
+}
+
+// every device shares count.yaml, so reads and writes are serialized
+var countMu sync.Mutex
+
+// SaveLastId stores the last notification id delivered for the named device.
+// The file is replaced atomically, so a crash leaves either the old or the new
+// cursor, never a broken file.
+func (c *Config) SaveLastId(name string, id int) error {
+	countMu.Lock()
+	defer countMu.Unlock()
+
+	state, err := c.readCountState()
+	if err != nil {
+		return err
+	}
+	state.Devices[name] = id
+	return c.writeCountState(state)
+}
+
+// GetLastKnowId returns the last notification id delivered for the named
+// device. The state file is created when missing, and false is returned when
+// the device has no cursor yet. The cursor of single-device versions is moved
+// to the first configured device, the one they polled; other devices start
+// without one.
+func (c *Config) GetLastKnowId(name string) (int, bool, error) {
+	countMu.Lock()
+	defer countMu.Unlock()
+
+	state, err := c.readCountState()
+	if errors.Is(err, fs.ErrNotExist) {
+		state = countState{Devices: map[string]int{}}
+		err = c.writeCountState(state)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if id, ok := state.Devices[name]; ok {
+		return id, true, nil
+	}
+	if state.Last > 0 && name == c.GetDevices()[0].Name {
+		id := state.Last
+		state.Devices[name] = id
+		state.Last = 0
+		err = c.writeCountState(state)
+		if err != nil {
+			return 0, false, err
+		}
+		return id, true, nil
+	}
+	return 0, false, nil
+}
+
+func (c *Config) readCountState() (countState, error) {
+	var state countState
+
+	data, err := os.ReadFile(c.countStatePath())
+	if err != nil {
+		return state, err
+	}
+	err = yaml.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("error reading %s: %w", c.countStatePath(), err)
+	}
+	if state.Devices == nil {
+		state.Devices = map[string]int{}
+	}
+	return state, nil
+}
+
+func (c *Config) writeCountState(state countState) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(c.GetStateDir(), 0o755)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(c.countStatePath(), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", c.countStatePath(), err)
+	}
+	return nil
+}
+
+func (c *Config) countStatePath() string {
+	return filepath.Join(c.GetStateDir(), countStateFile)
+}
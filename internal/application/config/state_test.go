@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLegacyCursor(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	yaml := fmt.Sprintf(`devices:
+  - name: rack-a
+    address: ups-a.example
+  - name: rack-b
+    address: ups-b.example
+state:
+  dir: %s
+`, dir)
+	err := os.WriteFile(file, []byte(yaml), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, countStateFile), []byte("last: 42\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, known, err := c.GetLastKnowId("rack-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known {
+		t.Errorf("rack-b got the cursor %d of the first device", id)
+	}
+	id, known, err = c.GetLastKnowId("rack-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !known || id != 42 {
+		t.Errorf("rack-a cursor %d (known %v), want 42", id, known)
+	}
+
+	// the cursor is moved, so it is never given to another device
+	state, err := c.readCountState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Last != 0 || state.Devices["rack-a"] != 42 {
+		t.Errorf("state %+v, want the cursor under rack-a only", state)
+	}
+}
@@ -1,5 +1,10 @@
 package utils
 
+import (
+	"os"
+	"path/filepath"
+)
+
 func CountStr(s string) int {
 	return len([]rune(s))
 }
@@ -28,3 +33,29 @@ func PadBegin(bb []byte, size int) []byte {
 	copy(tmp[size-l:], bb)
 	return tmp
 }
+
+// WriteFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never see a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
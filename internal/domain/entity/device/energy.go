@@ -0,0 +1,17 @@
+package device
+
+// EnergyUsage is the energy delivered by a UPS, in total and per day and
+// month, newest first.
+type EnergyUsage struct {
+	Device  string        `json:"device"`
+	TotalWh float64       `json:"total_wh"`
+	Watts   float64       `json:"watts"`
+	Days    []EnergyTotal `json:"days"`
+	Months  []EnergyTotal `json:"months"`
+}
+
+// EnergyTotal is the energy delivered in a day (2006-01-02) or month (2006-01).
+type EnergyTotal struct {
+	Period string  `json:"period"`
+	Wh     float64 `json:"wh"`
+}
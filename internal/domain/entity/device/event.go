@@ -0,0 +1,70 @@
+package device
+
+// EventType is the kind of event a UPS notification reports.
+type EventType string
+
+const (
+	EventUnknown         EventType = "unknown"
+	EventPowerFailure    EventType = "power_failure"
+	EventPowerRestored   EventType = "power_restored"
+	EventBatteryLow      EventType = "battery_low"
+	EventBatteryFault    EventType = "battery_fault"
+	EventTestStarted     EventType = "test_started"
+	EventTestFinished    EventType = "test_finished"
+	EventOverload        EventType = "overload"
+	EventOverTemperature EventType = "over_temperature"
+	EventShutdown        EventType = "shutdown"
+	EventAlertFiring     EventType = "alert_firing"
+	EventAlertResolved   EventType = "alert_resolved"
+	EventCommand         EventType = "command"
+
+	// a host shutdown was scheduled by the shutdown controller, and cancelled
+	// since the power came back; EventShutdown is sent once it runs
+	EventShutdownScheduled EventType = "shutdown_scheduled"
+	EventShutdownCancelled EventType = "shutdown_cancelled"
+)
+
+// Severity follows the syslog levels, the same used by GELF.
+type Severity int
+
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInformational
+	SeverityDebug
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityEmergency:
+		return "emergency"
+	case SeverityAlert:
+		return "alert"
+	case SeverityCritical:
+		return "critical"
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNotice:
+		return "notice"
+	case SeverityInformational:
+		return "info"
+	}
+	return "debug"
+}
+
+// ParseSeverity converts a severity name, as returned by String, back to a
+// Severity.
+func ParseSeverity(name string) (Severity, bool) {
+	for s := SeverityEmergency; s <= SeverityDebug; s++ {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return SeverityInformational, false
+}
@@ -3,18 +3,199 @@ package device
 import "time"
 
 type Config struct {
-	Device  `mapstructure:"device"`
-	Logs    `mapstructure:"logs"`
-	Metrics `mapstructure:"metrics"`
+	Device         `mapstructure:"device"`
+	Devices        []Device `mapstructure:"devices"`
+	Logs           `mapstructure:"logs"`
+	Notifiers      `mapstructure:"notifications"`
+	Alerts         `mapstructure:"alerts"`
+	Shutdown       `mapstructure:"shutdown"`
+	Energy         `mapstructure:"energy"`
+	BatteryRuntime `mapstructure:"battery_runtime"`
+	Outages        `mapstructure:"outages"`
+	UPSCommands    `mapstructure:"commands"`
+	Servers        `mapstructure:"servers"`
+	Metrics        `mapstructure:"metrics"`
+	State          `mapstructure:"state"`
+}
+
+type State struct {
+	Dir string `mapstructure:"dir"`
 }
 
 type Logs struct {
 	Gelf `mapstructure:"gelf"`
 }
 
+type Notifiers struct {
+	Webhook  `mapstructure:"webhook"`
+	Slack    `mapstructure:"slack"`
+	Telegram `mapstructure:"telegram"`
+	Ntfy     `mapstructure:"ntfy"`
+	Email    `mapstructure:"email"`
+}
+
+type Alerts struct {
+	Enabled bool        `mapstructure:"enabled"`
+	Rules   []AlertRule `mapstructure:"rules"`
+}
+
+type AlertRule struct {
+	Name       string        `mapstructure:"name"`
+	Expr       string        `mapstructure:"expr"`
+	For        time.Duration `mapstructure:"for"`
+	Hysteresis float64       `mapstructure:"hysteresis"`
+	Severity   string        `mapstructure:"severity"`
+	Devices    []string      `mapstructure:"devices"`
+}
+
+type Shutdown struct {
+	Enabled      bool              `mapstructure:"enabled"`
+	DryRun       bool              `mapstructure:"dry_run"`
+	Devices      []string          `mapstructure:"devices"`
+	BatteryLevel float64           `mapstructure:"battery_level"`
+	Runtime      time.Duration     `mapstructure:"runtime"`
+	OnBatteryFor time.Duration     `mapstructure:"on_battery_for"`
+	LostContact  time.Duration     `mapstructure:"lost_contact"`
+	GracePeriod  time.Duration     `mapstructure:"grace_period"`
+	AuditLog     string            `mapstructure:"audit_log"`
+	Commands     []ShutdownCommand `mapstructure:"commands"`
+}
+
+type ShutdownCommand struct {
+	Command string        `mapstructure:"command"`
+	Args    []string      `mapstructure:"args"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// UPSCommands are the commands sent to the UPSes. The shutdown commands are
+// experimental, since their API was never seen on a real UPS, and are only
+// accepted when Experimental is set.
+type UPSCommands struct {
+	Experimental bool `mapstructure:"experimental"`
+}
+
+type Energy struct {
+	Enabled bool          `mapstructure:"enabled"`
+	MaxGap  time.Duration `mapstructure:"max_gap"`
+}
+
+type BatteryRuntime struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	MinDischarge float64 `mapstructure:"min_discharge"`
+}
+
+type Outages struct {
+	Enabled bool          `mapstructure:"enabled"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
+}
+
+type Servers struct {
+	Nut     `mapstructure:"nut"`
+	Apcupsd `mapstructure:"apcupsd"`
+	Snmp    `mapstructure:"snmp"`
+	Api     `mapstructure:"api"`
+}
+
+type Api struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"`
+}
+
+type Apcupsd struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Listen     string        `mapstructure:"listen"`
+	Device     string        `mapstructure:"device"`
+	LowBattery float64       `mapstructure:"low_battery"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+}
+
+type Snmp struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Listen     string        `mapstructure:"listen"`
+	Device     string        `mapstructure:"device"`
+	Community  string        `mapstructure:"community"`
+	EngineID   string        `mapstructure:"engine_id"`
+	Users      []SnmpUser    `mapstructure:"users"`
+	LowBattery float64       `mapstructure:"low_battery"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+}
+
+type SnmpUser struct {
+	Username     string `mapstructure:"username"`
+	AuthProtocol string `mapstructure:"auth_protocol"`
+	AuthPassword string `mapstructure:"auth_password"`
+	PrivProtocol string `mapstructure:"priv_protocol"`
+	PrivPassword string `mapstructure:"priv_password"`
+}
+
+type Nut struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Listen     string        `mapstructure:"listen"`
+	Username   string        `mapstructure:"username"`
+	Password   string        `mapstructure:"password"`
+	LowBattery float64       `mapstructure:"low_battery"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+}
+
+type Webhook struct {
+	Enabled bool              `mapstructure:"enabled"`
+	Url     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+type Slack struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Url     string `mapstructure:"url"`
+}
+
+type Telegram struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"`
+	ChatID  string `mapstructure:"chat_id"`
+}
+
+type Ntfy struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Server  string `mapstructure:"server"`
+	Topic   string `mapstructure:"topic"`
+	Token   string `mapstructure:"token"`
+}
+
+type Email struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Host     string   `mapstructure:"host"`
+	Port     string   `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
 type Metrics struct {
 	Influx     `mapstructure:"influxdb"`
 	Prometheus `mapstructure:"prometheus"`
+	Mqtt       `mapstructure:"mqtt"`
+	Buffer     `mapstructure:"buffer"`
+}
+
+type Mqtt struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Broker          string        `mapstructure:"broker"`
+	ClientID        string        `mapstructure:"client_id"`
+	Username        string        `mapstructure:"username"`
+	Password        string        `mapstructure:"password"`
+	TopicPrefix     string        `mapstructure:"topic_prefix"`
+	QoS             byte          `mapstructure:"qos"`
+	Discovery       bool          `mapstructure:"discovery"`
+	DiscoveryPrefix string        `mapstructure:"discovery_prefix"`
+	MaxAge          time.Duration `mapstructure:"max_age"`
+}
+
+type Buffer struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Path    string        `mapstructure:"path"`
+	MaxSize int64         `mapstructure:"max_size"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
 }
 
 type Gelf struct {
@@ -23,24 +204,62 @@ type Gelf struct {
 }
 
 type Prometheus struct {
-	Enabled bool   `mapstructure:"enabled"`
-	Port    string `mapstructure:"port"`
-	Path    string `mapstructure:"path"`
+	Enabled bool          `mapstructure:"enabled"`
+	Port    string        `mapstructure:"port"`
+	Path    string        `mapstructure:"path"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
 }
 
 type Influx struct {
-	Enabled  bool   `mapstructure:"enabled"`
-	Address  string `mapstructure:"address"`
-	Port     string `mapstructure:"port"`
-	Database string `mapstructure:"database"`
+	Enabled         bool   `mapstructure:"enabled"`
+	Version         int    `mapstructure:"version"`
+	TLS             bool   `mapstructure:"tls"`
+	Address         string `mapstructure:"address"`
+	Port            string `mapstructure:"port"`
+	Database        string `mapstructure:"database"`
+	RetentionPolicy string `mapstructure:"retention_policy"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	Token           string `mapstructure:"token"`
+	Org             string `mapstructure:"org"`
+	Bucket          string `mapstructure:"bucket"`
+	Precision       string `mapstructure:"precision"`
+	Gzip            bool   `mapstructure:"gzip"`
 }
 
 type Device struct {
+	Name     string        `mapstructure:"name"`
 	Interval time.Duration `mapstructure:"interval"`
 	Address  string        `mapstructure:"address"`
 	LogLevel string        `mapstructure:"log"`
 	Login    `mapstructure:"login"`
 	Http     `mapstructure:"http"`
+	Fixtures `mapstructure:"fixtures"`
+	Rating   `mapstructure:"rating"`
+	Battery  `mapstructure:"battery"`
+}
+
+// Rating is the nominal output of the UPS, used to turn its load percentage
+// into watts. Without Watts, it is VA times PowerFactor.
+type Rating struct {
+	VA          float64 `mapstructure:"va"`
+	Watts       float64 `mapstructure:"watts"`
+	PowerFactor float64 `mapstructure:"power_factor"`
+}
+
+// Fixtures records the requests to the UPS and their responses to a
+// directory, or answers them from a directory recorded before.
+type Fixtures struct {
+	Record string `mapstructure:"record"`
+	Replay string `mapstructure:"replay"`
+}
+
+// Battery is the battery bank of the UPS, used to estimate its runtime until
+// enough discharges were observed.
+type Battery struct {
+	Voltage    float64 `mapstructure:"voltage"`
+	CapacityAh float64 `mapstructure:"capacity_ah"`
+	Efficiency float64 `mapstructure:"efficiency"`
 }
 
 type Http struct {
@@ -62,8 +281,13 @@ type HttpClient struct {
 }
 
 type Login struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	TokenTTL time.Duration `mapstructure:"token_ttl"`
+}
+
+type CommandResponse struct {
+	ResponseStatus string `json:"responseStatus"`
 }
 
 type Notifications struct {
@@ -71,9 +295,12 @@ type Notifications struct {
 	Notifications  []Notification `json:"notificacoes"`
 }
 type Notification struct {
-	ID      int    `json:"id"`
-	Message string `json:"msg"`
-	Date    string `json:"data"`
+	ID       int       `json:"id"`
+	Message  string    `json:"msg"`
+	Date     string    `json:"data"`
+	Device   string    `json:"-"`
+	Type     EventType `json:"-"`
+	Severity Severity  `json:"-"`
 }
 
 type Metric struct {
@@ -85,6 +312,7 @@ type Metric struct {
 	DeployName     string    `json:"deployName"`
 	Alert24HState  string    `json:"alerta24hState"`
 	GetAt          time.Time `json:"GetAt"`
+	Device         string    `json:"-"`
 }
 type Phases struct {
 	Value string `json:"valor"`
@@ -0,0 +1,31 @@
+package device
+
+import "time"
+
+// Outage is a time a UPS ran on battery, without End while it still does.
+// MinBattery and MaxLoad come from the readings taken during it, and are
+// unknown when Readings is 0.
+type Outage struct {
+	Device     string     `json:"device"`
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"`
+	Seconds    float64    `json:"duration_seconds"`
+	MinBattery float64    `json:"min_battery"`
+	MaxLoad    float64    `json:"max_load"`
+	Readings   int        `json:"readings"`
+}
+
+// OutageDay sums the outages of a day (2006-01-02). Count is the outages that
+// started in the day, and Seconds the time on battery within it.
+type OutageDay struct {
+	Date    string  `json:"date"`
+	Count   int     `json:"count"`
+	Seconds float64 `json:"duration_seconds"`
+}
+
+// OutageReport lists the outages of a period and their daily totals, newest
+// first.
+type OutageReport struct {
+	Outages []Outage    `json:"outages"`
+	Days    []OutageDay `json:"days"`
+}
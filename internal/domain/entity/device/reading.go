@@ -0,0 +1,137 @@
+package device
+
+import "time"
+
+// Quantity is a value measured by the UPS. Names are the ones exported by
+// every writer.
+type Quantity string
+
+const (
+	QuantityInputVoltage    Quantity = "input_voltage"
+	QuantityOutputVoltage   Quantity = "output_voltage"
+	QuantityBatteryLevel    Quantity = "battery_level"
+	QuantityLoad            Quantity = "ups_load"
+	QuantityTemperature     Quantity = "ups_temperature"
+	QuantityOutputFrequency Quantity = "output_frequency"
+)
+
+// Status is a condition of the UPS, either set or not.
+type Status string
+
+const (
+	StatusInteractive Status = "ups_is_interative"
+	StatusBatteryFail Status = "battery_fail"
+	StatusBatteryFull Status = "battery_is_full"
+	StatusOnGrid      Status = "on_grid"
+	StatusTest        Status = "on_test"
+	StatusAlert24h    Status = "alert_24h"
+	StatusBoost       Status = "on_boost"
+	StatusBypass      Status = "on_bypass"
+	StatusHighPower   Status = "on_high_power"
+	StatusWifi        Status = "is_wifi_ups"
+	StatusRGB         Status = "have_rgb"
+)
+
+// Quantities returns every quantity, in the order writers export them.
+func Quantities() []Quantity {
+	return []Quantity{
+		QuantityInputVoltage,
+		QuantityOutputVoltage,
+		QuantityBatteryLevel,
+		QuantityLoad,
+		QuantityTemperature,
+		QuantityOutputFrequency,
+	}
+}
+
+// Statuses returns every status, in the order writers export them.
+func Statuses() []Status {
+	return []Status{
+		StatusInteractive,
+		StatusBatteryFail,
+		StatusBatteryFull,
+		StatusOnGrid,
+		StatusTest,
+		StatusAlert24h,
+		StatusBoost,
+		StatusBypass,
+		StatusHighPower,
+		StatusWifi,
+		StatusRGB,
+	}
+}
+
+// Unit is the unit every measurement of the quantity is in.
+func (q Quantity) Unit() string {
+	switch q {
+	case QuantityInputVoltage, QuantityOutputVoltage:
+		return "V"
+	case QuantityBatteryLevel, QuantityLoad:
+		return "%"
+	case QuantityTemperature:
+		return "°C"
+	case QuantityOutputFrequency:
+		return "Hz"
+	}
+	return ""
+}
+
+// Measurement is a quantity read from the UPS. When HasRange is set, Min and
+// Max are the extremes the UPS itself saw since it was last read, catching
+// sags shorter than the polling interval.
+type Measurement struct {
+	Value    float64 `json:"value"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	HasRange bool    `json:"has_range"`
+	Unit     string  `json:"unit"`
+}
+
+// Reading is a normalized Metric: the measurements and statuses the UPS
+// reported, by their exported name. Missing entries were not reported.
+type Reading struct {
+	Device       string                   `json:"device"`
+	DeployID     string                   `json:"deploy_id"`
+	DeployName   string                   `json:"deploy_name"`
+	UPSType      string                   `json:"ups_type"`
+	GetAt        time.Time                `json:"get_at"`
+	Measurements map[Quantity]Measurement `json:"measurements"`
+	Statuses     map[Status]bool          `json:"statuses"`
+}
+
+// Value returns the value of the quantity, if it was reported.
+func (r Reading) Value(q Quantity) (float64, bool) {
+	m, ok := r.Measurements[q]
+	return m.Value, ok
+}
+
+// Is returns whether the status is set, and if it was reported.
+func (r Reading) Is(s Status) (set bool, ok bool) {
+	set, ok = r.Statuses[s]
+	return set, ok
+}
+
+// Values returns the measurements and statuses by their exported name.
+// Statuses are 1 when set and 0 otherwise.
+func (r Reading) Values() map[string]float64 {
+	values := make(map[string]float64, len(r.Measurements)+len(r.Statuses))
+
+	for q, m := range r.Measurements {
+		values[string(q)] = m.Value
+	}
+	for s, set := range r.Statuses {
+		var v float64
+		if set {
+			v = 1
+		}
+		values[string(s)] = v
+	}
+	return values
+}
+
+// RuntimeEstimator tells the remaining battery runtime of a device, when
+// known. It is implemented by the battery runtime estimation, and used by
+// the alerts, the shutdown and the servers that report the runtime.
+type RuntimeEstimator interface {
+	Runtime(name string) (time.Duration, bool)
+}
@@ -0,0 +1,166 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const dateLayout = "02/01/2006 15:04:05"
+
+// Alert evaluates the configured rules over every metric it receives, and
+// sends a notification when a rule starts and stops firing. The estimated
+// battery runtime is evaluated as battery_runtime, in seconds.
+type Alert struct {
+	log       *logger.Logger
+	sink      notifier.NotificationSink
+	estimator device.RuntimeEstimator
+	rules     []rule
+	mu        sync.Mutex
+	states    map[string]*state
+	pending   []device.Notification
+}
+
+type state struct {
+	since  time.Time
+	active bool
+}
+
+func NewAlert(l *application.Application, sink notifier.NotificationSink, estimator device.RuntimeEstimator) (writer.WriteMetric, error) {
+	return newAlert(l.Log.With("job", "alerts"), l.Config.GetAlertsConfig().Rules, sink, estimator)
+}
+
+func newAlert(log *logger.Logger, cfgs []device.AlertRule, sink notifier.NotificationSink, estimator device.RuntimeEstimator) (*Alert, error) {
+	var rules []rule
+
+	for _, cfg := range cfgs {
+		r, err := parseRule(cfg)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return &Alert{
+		log:       log,
+		sink:      sink,
+		estimator: estimator,
+		rules:     rules,
+		states:    make(map[string]*state),
+	}, nil
+}
+
+// Write evaluates the rules, using the time the UPS was read so for
+// durations hold even when readings arrive late.
+func (a *Alert) Write(ctx context.Context, reading device.Reading) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	values := reading.Values()
+	if a.estimator != nil {
+		if runtime, ok := a.estimator.Runtime(reading.Device); ok {
+			values[metricBatteryRuntime] = runtime.Seconds()
+		}
+	}
+
+	for _, r := range a.rules {
+		if !r.appliesTo(reading.Device) {
+			continue
+		}
+		key := reading.Device + "/" + r.name
+		s, ok := a.states[key]
+		if !ok {
+			s = &state{}
+			a.states[key] = s
+		}
+		value, ok := values[r.metric]
+		if !ok {
+			a.missing(r, s, reading)
+			continue
+		}
+		a.evaluate(r, s, reading, value)
+	}
+	return a.flush(ctx)
+}
+
+func (a *Alert) evaluate(r rule, s *state, reading device.Reading, value float64) {
+	firing := r.firing(value, s.active)
+
+	switch {
+	case firing && !s.active:
+		if s.since.IsZero() {
+			s.since = reading.GetAt
+		}
+		if reading.GetAt.Sub(s.since) < r.forTime {
+			return
+		}
+		s.active = true
+		UPSAlertsFiring.WithLabelValues(reading.Device, r.name).Set(1)
+		a.notify(r, reading, formatValue(value), device.EventAlertFiring, r.severity)
+	case !firing && s.active:
+		s.active = false
+		s.since = time.Time{}
+		UPSAlertsFiring.WithLabelValues(reading.Device, r.name).Set(0)
+		a.notify(r, reading, formatValue(value), device.EventAlertResolved, device.SeverityNotice)
+	case !firing:
+		s.since = time.Time{}
+	}
+}
+
+// missing resolves the alert when the reading no longer has its value, like
+// a runtime the estimator stopped knowing, since the condition can't be told
+// to hold anymore.
+func (a *Alert) missing(r rule, s *state, reading device.Reading) {
+	s.since = time.Time{}
+	if !s.active {
+		return
+	}
+	s.active = false
+	UPSAlertsFiring.WithLabelValues(reading.Device, r.name).Set(0)
+	a.notify(r, reading, "missing", device.EventAlertResolved, device.SeverityNotice)
+}
+
+func formatValue(value float64) string {
+	return "value " + strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (a *Alert) notify(r rule, reading device.Reading, detail string, event device.EventType, severity device.Severity) {
+	status := "FIRING"
+	if event == device.EventAlertResolved {
+		status = "RESOLVED"
+	}
+	message := fmt.Sprintf("[%s] %s: %s (%s)", status, r.name, r, detail)
+	a.log.Warnf("alert of %s: %s", reading.Device, message)
+
+	a.pending = append(a.pending, device.Notification{
+		Message:  message,
+		Date:     reading.GetAt.Format(dateLayout),
+		Device:   reading.Device,
+		Type:     event,
+		Severity: severity,
+	})
+}
+
+// flush sends the pending alert notifications, keeping the ones that failed
+// to be retried on the next reading.
+func (a *Alert) flush(ctx context.Context) error {
+	var errs []error
+	var failed []device.Notification
+
+	for _, n := range a.pending {
+		err := a.sink.Send(ctx, n)
+		if err != nil {
+			errs = append(errs, err)
+			failed = append(failed, n)
+		}
+	}
+	a.pending = failed
+	return errors.Join(errs...)
+}
@@ -0,0 +1,187 @@
+package alert
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sink struct {
+	sent []device.Notification
+}
+
+func (s *sink) Send(_ context.Context, n device.Notification) error {
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+// statuses returns the status of each notification, like "FIRING", and the
+// device it was for.
+func (s *sink) statuses() []string {
+	var statuses []string
+	for _, n := range s.sent {
+		status, _, _ := strings.Cut(strings.TrimPrefix(n.Message, "["), "]")
+		statuses = append(statuses, n.Device+" "+status)
+	}
+	return statuses
+}
+
+// estimator knows the runtime of the devices in it.
+type estimator map[string]time.Duration
+
+func (e estimator) Runtime(name string) (time.Duration, bool) {
+	runtime, ok := e[name]
+	return runtime, ok
+}
+
+func newTestAlert(t *testing.T, est device.RuntimeEstimator, rules ...device.AlertRule) (*Alert, *sink) {
+	t.Helper()
+	s := &sink{}
+	a, err := newAlert(logger.NewLogger(), rules, s, est)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, s
+}
+
+var start = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// write sends a battery level read at the given offset from start.
+func write(t *testing.T, a *Alert, name string, at time.Duration, level float64) {
+	t.Helper()
+	err := a.Write(context.Background(), device.Reading{
+		Device: name,
+		GetAt:  start.Add(at),
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: level},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFor(t *testing.T) {
+	a, s := newTestAlert(t, nil, device.AlertRule{Name: "low", Expr: "battery_level < 40", For: time.Minute})
+
+	write(t, a, "rack", 0, 30)
+	write(t, a, "rack", 30*time.Second, 30)
+	if len(s.sent) > 0 {
+		t.Fatalf("fired before the for duration: %v", s.statuses())
+	}
+	// the condition stopped holding, so the duration starts over
+	write(t, a, "rack", 40*time.Second, 50)
+	write(t, a, "rack", 50*time.Second, 30)
+	write(t, a, "rack", 80*time.Second, 30)
+	if len(s.sent) > 0 {
+		t.Fatalf("fired before the for duration held again: %v", s.statuses())
+	}
+	write(t, a, "rack", 110*time.Second, 30)
+	if want := []string{"rack FIRING"}; !slices.Equal(s.statuses(), want) {
+		t.Fatalf("notifications %v, want %v", s.statuses(), want)
+	}
+	if got := s.sent[0].Date; got != "01/03/2024 10:01:50" {
+		t.Errorf("notification dated %s, want the time of the reading", got)
+	}
+}
+
+func TestFiring(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		active   bool
+		want     bool
+	}{
+		{operator: "<", value: 39, want: true},
+		{operator: "<", value: 42},
+		{operator: "<", value: 42, active: true, want: true},
+		{operator: "<", value: 45, active: true},
+		{operator: "<=", value: 45, active: true, want: true},
+		{operator: ">", value: 38, active: true, want: true},
+		{operator: ">", value: 35, active: true},
+		{operator: ">=", value: 35, active: true, want: true},
+		{operator: "==", value: 42, active: true},
+		{operator: "!=", value: 42, active: true, want: true},
+	}
+	for _, tt := range tests {
+		r, err := parseRule(device.AlertRule{Expr: "battery_level " + tt.operator + " 40", Hysteresis: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.firing(tt.value, tt.active); got != tt.want {
+			t.Errorf("%s with %v (active %v): firing %v, want %v", r, tt.value, tt.active, got, tt.want)
+		}
+	}
+}
+
+func TestResolved(t *testing.T) {
+	a, s := newTestAlert(t, nil, device.AlertRule{Name: "low", Expr: "battery_level < 40", Hysteresis: 5, Severity: "critical"})
+
+	write(t, a, "rack", 0, 30)
+	// inside the hysteresis band, still firing
+	write(t, a, "rack", time.Minute, 42)
+	write(t, a, "rack", 2*time.Minute, 50)
+	if want := []string{"rack FIRING", "rack RESOLVED"}; !slices.Equal(s.statuses(), want) {
+		t.Fatalf("notifications %v, want %v", s.statuses(), want)
+	}
+	firing, resolved := s.sent[0], s.sent[1]
+	if firing.Type != device.EventAlertFiring || firing.Severity != device.SeverityCritical {
+		t.Errorf("firing sent as %s/%s", firing.Type, firing.Severity)
+	}
+	if resolved.Type != device.EventAlertResolved || resolved.Severity != device.SeverityNotice {
+		t.Errorf("resolved sent as %s/%s", resolved.Type, resolved.Severity)
+	}
+	if want := "[RESOLVED] low: battery_level < 40 (value 50)"; resolved.Message != want {
+		t.Errorf("message %q, want %q", resolved.Message, want)
+	}
+}
+
+func TestStatePerDevice(t *testing.T) {
+	a, s := newTestAlert(t, nil,
+		device.AlertRule{Name: "low", Expr: "battery_level < 40"},
+		device.AlertRule{Name: "rack-b low", Expr: "battery_level < 60", Devices: []string{"rack-b"}},
+	)
+
+	write(t, a, "rack-a", 0, 30)
+	write(t, a, "rack-b", 0, 50)
+	write(t, a, "rack-b", time.Minute, 70)
+	write(t, a, "rack-a", time.Minute, 30)
+	want := []string{"rack-a FIRING", "rack-b FIRING", "rack-b RESOLVED"}
+	if !slices.Equal(s.statuses(), want) {
+		t.Fatalf("notifications %v, want %v", s.statuses(), want)
+	}
+	if !strings.HasPrefix(s.sent[1].Message, "[FIRING] rack-b low:") {
+		t.Errorf("rack-b fired %q, want the rack-b low rule", s.sent[1].Message)
+	}
+	if _, ok := a.states["rack-a/rack-b low"]; ok {
+		t.Error("the rack-b rule was evaluated for rack-a")
+	}
+	if !a.states["rack-a/low"].active || a.states["rack-b/low"].active {
+		t.Errorf("low active on rack-a %v, rack-b %v; want rack-a only", a.states["rack-a/low"].active, a.states["rack-b/low"].active)
+	}
+}
+
+func TestMissingValue(t *testing.T) {
+	est := estimator{"rack": 2 * time.Minute}
+	a, s := newTestAlert(t, est, device.AlertRule{Name: "short", Expr: "battery_runtime < 300"})
+
+	write(t, a, "rack", 0, 30)
+	delete(est, "rack")
+	write(t, a, "rack", time.Minute, 30)
+	if want := []string{"rack FIRING", "rack RESOLVED"}; !slices.Equal(s.statuses(), want) {
+		t.Fatalf("notifications %v, want %v", s.statuses(), want)
+	}
+	if want := "[RESOLVED] short: battery_runtime < 300 (missing)"; s.sent[1].Message != want {
+		t.Errorf("message %q, want %q", s.sent[1].Message, want)
+	}
+	// the runtime comes back and the alert fires again
+	est["rack"] = time.Minute
+	write(t, a, "rack", 2*time.Minute, 30)
+	if len(s.sent) != 3 || s.sent[2].Type != device.EventAlertFiring {
+		t.Errorf("notifications %v, want firing again", s.statuses())
+	}
+}
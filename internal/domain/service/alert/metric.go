@@ -0,0 +1,12 @@
+package alert
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var UPSAlertsFiring = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "alerts_firing",
+	Help:      "Whether an alert rule is firing for the UPS",
+}, []string{"device", "rule"})
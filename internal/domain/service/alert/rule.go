@@ -0,0 +1,126 @@
+package alert
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricBatteryRuntime is the estimated battery runtime, in seconds, added to
+// the values of a reading when it is known.
+const metricBatteryRuntime = "battery_runtime"
+
+type rule struct {
+	name       string
+	metric     string
+	operator   string
+	threshold  float64
+	forTime    time.Duration
+	hysteresis float64
+	severity   device.Severity
+	devices    []string
+}
+
+// parseRule reads a rule expression in the form "<metric> <operator> <value>",
+// like "battery_level < 40" or "on_grid == 0".
+func parseRule(cfg device.AlertRule) (rule, error) {
+	fields := strings.Fields(cfg.Expr)
+	if len(fields) != 3 {
+		return rule{}, fmt.Errorf("alert %s: invalid expression %q", cfg.Name, cfg.Expr)
+	}
+	if !knownMetric(fields[0]) {
+		return rule{}, fmt.Errorf("alert %s: unknown metric %q", cfg.Name, fields[0])
+	}
+	operator := fields[1]
+	if !slices.Contains([]string{"<", "<=", ">", ">=", "==", "!="}, operator) {
+		return rule{}, fmt.Errorf("alert %s: invalid operator %q", cfg.Name, operator)
+	}
+	threshold, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return rule{}, fmt.Errorf("alert %s: invalid threshold %q", cfg.Name, fields[2])
+	}
+
+	severity := device.SeverityWarning
+	if cfg.Severity != "" {
+		var ok bool
+		severity, ok = device.ParseSeverity(cfg.Severity)
+		if !ok {
+			return rule{}, fmt.Errorf("alert %s: invalid severity %q", cfg.Name, cfg.Severity)
+		}
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Expr
+	}
+	return rule{
+		name:       name,
+		metric:     fields[0],
+		operator:   operator,
+		threshold:  threshold,
+		forTime:    cfg.For,
+		hysteresis: cfg.Hysteresis,
+		severity:   severity,
+		devices:    cfg.Devices,
+	}, nil
+}
+
+// knownMetric tells whether name is a quantity or status of a reading, or
+// the battery runtime.
+func knownMetric(name string) bool {
+	if name == metricBatteryRuntime {
+		return true
+	}
+	for _, q := range device.Quantities() {
+		if string(q) == name {
+			return true
+		}
+	}
+	for _, s := range device.Statuses() {
+		if string(s) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) appliesTo(name string) bool {
+	return len(r.devices) == 0 || slices.Contains(r.devices, name)
+}
+
+// firing tells whether the condition holds. When the alert is already firing,
+// the threshold is moved by the hysteresis, so the value has to get clear of
+// it before the alert resolves.
+func (r rule) firing(value float64, active bool) bool {
+	threshold := r.threshold
+	if active {
+		switch r.operator {
+		case "<", "<=":
+			threshold += r.hysteresis
+		case ">", ">=":
+			threshold -= r.hysteresis
+		}
+	}
+	switch r.operator {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+func (r rule) String() string {
+	return fmt.Sprintf("%s %s %s", r.metric, r.operator, strconv.FormatFloat(r.threshold, 'f', -1, 64))
+}
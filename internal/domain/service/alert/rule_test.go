@@ -0,0 +1,32 @@
+package alert
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{expr: "battery_level < 40", ok: true},
+		{expr: "on_grid == 0", ok: true},
+		{expr: "battery_runtime <= 300", ok: true},
+		{expr: "batery_level < 40"},
+		{expr: "battery_level =< 40"},
+		{expr: "battery_level < low"},
+		{expr: "battery_level <"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseRule(device.AlertRule{Expr: tt.expr})
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package battery
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const stateFile = `battery.yaml`
+
+// the discharge curve keeps a segment per bucketSize points of load
+const (
+	bucketSize = 10
+	buckets    = 100/bucketSize + 1
+)
+
+// maxSeconds is how much on battery time a segment keeps. Older discharges
+// are weighted down past it, so the curve follows the battery as it ages.
+const maxSeconds = 4 * 3600
+
+type state struct {
+	Devices map[string]*curve `yaml:"devices"`
+}
+
+// curve is how fast the battery of a device discharged at each load, learned
+// from the time it spent on battery.
+type curve struct {
+	Segments map[int]*segment `yaml:"segments"`
+}
+
+// segment sums the discharges observed with the load in a bucket.
+type segment struct {
+	Seconds     float64 `yaml:"seconds"`
+	Discharge   float64 `yaml:"discharge"`
+	LoadSeconds float64 `yaml:"load_seconds"`
+}
+
+func newCurve() *curve {
+	return &curve{Segments: map[int]*segment{}}
+}
+
+func bucket(load float64) int {
+	return min(max(int(load)/bucketSize, 0), buckets-1)
+}
+
+// observe adds seconds on battery at load, in which the level dropped by
+// discharge points.
+func (c *curve) observe(seconds, load, discharge float64) {
+	b := bucket(load)
+	s, ok := c.Segments[b]
+	if !ok {
+		s = &segment{}
+		c.Segments[b] = s
+	}
+	s.Seconds += seconds
+	s.Discharge += discharge
+	s.LoadSeconds += load * seconds
+
+	if s.Seconds > maxSeconds {
+		scale := maxSeconds / s.Seconds
+		s.Seconds *= scale
+		s.Discharge *= scale
+		s.LoadSeconds *= scale
+	}
+}
+
+// rate returns the battery points lost per second at load, from the closest
+// segment that discharged at least minDischarge points. The rate is taken as
+// proportional to the load, to move it from the mean load of the segment.
+func (c *curve) rate(load, minDischarge float64) (float64, bool) {
+	want := bucket(load)
+	for distance := 0; distance < buckets; distance++ {
+		for _, b := range []int{want - distance, want + distance} {
+			s, ok := c.Segments[b]
+			if !ok || s.Discharge < minDischarge || s.Seconds <= 0 {
+				continue
+			}
+			rate := s.Discharge / s.Seconds
+			mean := s.LoadSeconds / s.Seconds
+			if mean >= 1 {
+				rate *= max(load, 1) / mean
+			}
+			return rate, true
+		}
+	}
+	return 0, false
+}
+
+func loadState(path string) (state, error) {
+	s := state{Devices: map[string]*curve{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading %s: %w", path, err)
+	}
+	err = yaml.Unmarshal(data, &s)
+	if err != nil {
+		return s, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Devices == nil {
+		s.Devices = map[string]*curve{}
+	}
+	for name, c := range s.Devices {
+		if c == nil {
+			delete(s.Devices, name)
+			continue
+		}
+		for b, seg := range c.Segments {
+			if seg == nil || b < 0 || b >= buckets {
+				delete(c.Segments, b)
+			}
+		}
+		if c.Segments == nil {
+			c.Segments = map[int]*segment{}
+		}
+	}
+	return s, nil
+}
+
+func saveState(path string, s state) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(path, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
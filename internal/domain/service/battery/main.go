@@ -0,0 +1,178 @@
+package battery
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxGaps is how many polling intervals may be missed between two readings
+// on battery for the discharge between them to be learned.
+const maxGaps = 3
+
+// maxRuntime bounds the estimate, which grows without limit as the load
+// goes to zero.
+const maxRuntime = 24 * time.Hour
+
+// Estimator estimates how long the battery of each UPS powers its current
+// load. It learns how fast the battery discharges at each load while the UPS
+// is on battery, and until it has seen enough it falls back to the battery
+// capacity and rating configured for the device. Learned curves are kept in
+// the state dir across restarts.
+type Estimator struct {
+	log          *logger.Logger
+	path         string
+	minDischarge float64
+	devices      map[string]device.Device
+	mu           sync.Mutex
+	state        state
+	last         map[string]sample
+	runtime      map[string]time.Duration
+}
+
+type sample struct {
+	at        time.Time
+	level     float64
+	load      float64
+	onBattery bool
+}
+
+func NewEstimator(l *application.Application) (*Estimator, error) {
+	path := filepath.Join(l.Config.GetStateDir(), stateFile)
+	return newEstimator(l.Log.With("job", "battery_runtime"), path, l.Config.GetBatteryRuntimeConfig().MinDischarge, l.Config.GetDevices())
+}
+
+func newEstimator(log *logger.Logger, path string, minDischarge float64, devices []device.Device) (*Estimator, error) {
+	e := &Estimator{
+		log:          log,
+		path:         path,
+		minDischarge: minDischarge,
+		devices:      make(map[string]device.Device),
+		last:         make(map[string]sample),
+		runtime:      make(map[string]time.Duration),
+	}
+	s, err := loadState(e.path)
+	if err != nil {
+		return nil, err
+	}
+	e.state = s
+
+	for _, d := range devices {
+		e.devices[d.Name] = d
+		if _, ok := e.state.Devices[d.Name]; !ok {
+			e.state.Devices[d.Name] = newCurve()
+		}
+	}
+	return e, nil
+}
+
+// Write learns the discharge since the previous reading when the UPS was on
+// battery for both, and estimates the runtime at the current level and load.
+// The curve is saved when the UPS is back on grid.
+func (e *Estimator) Write(_ context.Context, reading device.Reading) error {
+	c, ok := e.state.Devices[reading.Device]
+	if !ok {
+		return nil
+	}
+	level, ok := reading.Value(device.QuantityBatteryLevel)
+	if !ok {
+		return nil
+	}
+	load, ok := reading.Value(device.QuantityLoad)
+	if !ok {
+		return nil
+	}
+	onGrid, ok := reading.Is(device.StatusOnGrid)
+	if !ok {
+		return nil
+	}
+	now := sample{
+		at:        reading.GetAt,
+		level:     level,
+		load:      load,
+		onBattery: !onGrid,
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var err error
+	if prev, ok := e.last[reading.Device]; ok {
+		elapsed := now.at.Sub(prev.at)
+		switch {
+		case elapsed <= 0:
+			return nil
+		case prev.onBattery && now.onBattery && elapsed <= maxGaps*e.devices[reading.Device].Interval:
+			c.observe(elapsed.Seconds(), (prev.load+now.load)/2, prev.level-now.level)
+		case prev.onBattery && !now.onBattery:
+			e.log.Infof("%s back on grid, saving its discharge curve", reading.Device)
+			err = e.save()
+		}
+	}
+	e.last[reading.Device] = now
+
+	runtime, ok := e.estimate(reading.Device, c, now)
+	if !ok {
+		delete(e.runtime, reading.Device)
+		UPSBatteryRuntime.DeleteLabelValues(reading.Device)
+		return err
+	}
+	e.runtime[reading.Device] = runtime
+	UPSBatteryRuntime.WithLabelValues(reading.Device).Set(runtime.Seconds())
+	return err
+}
+
+// estimate uses the learned curve, or the battery capacity when the curve has
+// not discharged enough yet.
+func (e *Estimator) estimate(name string, c *curve, s sample) (time.Duration, bool) {
+	if s.level <= 0 {
+		return 0, true
+	}
+	if rate, ok := c.rate(s.load, e.minDischarge); ok && rate > 0 {
+		runtime := seconds(s.level / rate)
+		e.log.Debugf("%s runtime %s from the learned curve", name, runtime)
+		return runtime, true
+	}
+
+	d := e.devices[name]
+	wh := d.Battery.Voltage * d.Battery.CapacityAh * d.Battery.Efficiency * s.level / 100
+	watts := d.Rating.Watts * s.load / 100
+	if wh <= 0 || watts <= 0 {
+		return 0, false
+	}
+	runtime := seconds(wh / watts * 3600)
+	e.log.Debugf("%s runtime %s from the battery capacity", name, runtime)
+	return runtime, true
+}
+
+// Runtime returns the runtime estimated at the last reading of the device.
+// A nil Estimator knows no runtime, so it can be handed to every consumer
+// when the estimation is disabled.
+func (e *Estimator) Runtime(name string) (time.Duration, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	runtime, ok := e.runtime[name]
+	return runtime, ok
+}
+
+// Close writes the learned curves to the state dir.
+func (e *Estimator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.save()
+}
+
+func (e *Estimator) save() error {
+	return saveState(e.path, e.state)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(min(s, maxRuntime.Seconds()) * float64(time.Second)).Round(time.Second)
+}
@@ -0,0 +1,154 @@
+package battery
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	c := newCurve()
+	c.observe(60, 52, 1)
+	c.observe(120, 55, 3)
+	c.observe(60, 150, 2)
+	c.observe(60, -5, 1)
+
+	s := c.Segments[bucket(50)]
+	if s == nil || s.Seconds != 180 || s.Discharge != 4 || s.LoadSeconds != 52*60+55*120 {
+		t.Fatalf("segment %+v, want both observations at load 50", s)
+	}
+	if _, ok := c.Segments[buckets-1]; !ok {
+		t.Error("a load over 100 was not kept in the last segment")
+	}
+	if _, ok := c.Segments[0]; !ok {
+		t.Error("a negative load was not kept in the first segment")
+	}
+
+	// past maxSeconds the segment is scaled down, keeping its rate
+	c.observe(maxSeconds, 50, maxSeconds/60)
+	s = c.Segments[bucket(50)]
+	if s.Seconds != maxSeconds {
+		t.Errorf("segment kept %v seconds, want %v", s.Seconds, maxSeconds)
+	}
+	if rate := s.Discharge / s.Seconds; rate <= 1.0/60 || rate >= 4.0/180 {
+		t.Errorf("rate %v after scaling, want between both observed rates", rate)
+	}
+}
+
+func TestRate(t *testing.T) {
+	c := newCurve()
+	// 2 points per minute at a 20% load
+	c.observe(300, 20, 10)
+	// too little discharge to be used
+	c.observe(60, 60, 1)
+
+	rate, ok := c.rate(60, 5)
+	if !ok {
+		t.Fatal("no rate from the closest segment")
+	}
+	// proportional to the load, from the mean load of the segment
+	if want := 3 * 2.0 / 60; rate != want {
+		t.Errorf("rate %v, want %v", rate, want)
+	}
+	_, ok = c.rate(60, 20)
+	if ok {
+		t.Error("a rate was given with no segment discharged enough")
+	}
+}
+
+func newTestEstimator(t *testing.T, path string, d device.Device) *Estimator {
+	t.Helper()
+	e, err := newEstimator(logger.NewLogger(), path, 5, []device.Device{d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+var start = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func write(t *testing.T, e *Estimator, at time.Duration, onGrid bool, level, load float64) {
+	t.Helper()
+	err := e.Write(context.Background(), device.Reading{
+		Device: "rack",
+		GetAt:  start.Add(at),
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: level},
+			device.QuantityLoad:         {Value: load},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: onGrid,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLearning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateFile)
+	// no battery configured, so only a learned curve gives a runtime
+	e := newTestEstimator(t, path, device.Device{Name: "rack", Interval: time.Minute})
+
+	write(t, e, 0, false, 100, 50)
+	write(t, e, time.Minute, false, 98, 50)
+	write(t, e, 2*time.Minute, false, 96, 50)
+	if runtime, ok := e.Runtime("rack"); ok {
+		t.Fatalf("runtime %s before discharging the minimum", runtime)
+	}
+	write(t, e, 3*time.Minute, false, 94, 50)
+	runtime, ok := e.Runtime("rack")
+	if !ok {
+		t.Fatal("no runtime from the learned curve")
+	}
+	// 2 points a minute
+	if want := 47 * time.Minute; runtime != want {
+		t.Errorf("runtime %s, want %s", runtime, want)
+	}
+
+	// readings too far apart are not learned
+	write(t, e, 10*time.Minute, false, 70, 50)
+	if s := e.state.Devices["rack"].Segments[bucket(50)]; s.Seconds != 180 || s.Discharge != 6 {
+		t.Errorf("segment %+v, want the gap left out", s)
+	}
+
+	// the curve is saved once back on grid
+	write(t, e, 11*time.Minute, true, 70, 50)
+	e = newTestEstimator(t, path, device.Device{Name: "rack", Interval: time.Minute})
+	if s := e.state.Devices["rack"].Segments[bucket(50)]; s == nil || s.Discharge != 6 {
+		t.Errorf("segment %+v after a restart, want the learned one", s)
+	}
+}
+
+func TestCapacityFallback(t *testing.T) {
+	e := newTestEstimator(t, filepath.Join(t.TempDir(), stateFile), device.Device{
+		Name:     "rack",
+		Interval: time.Minute,
+		Rating:   device.Rating{Watts: 600},
+		Battery:  device.Battery{Voltage: 12, CapacityAh: 9, Efficiency: 0.8},
+	})
+
+	// 43.2Wh left at 300W
+	write(t, e, 0, true, 50, 50)
+	runtime, ok := e.Runtime("rack")
+	if !ok {
+		t.Fatal("no runtime from the battery capacity")
+	}
+	if want := 518 * time.Second; runtime != want {
+		t.Errorf("runtime %s, want %s", runtime, want)
+	}
+	write(t, e, time.Minute, true, 50, 0)
+	if runtime, ok := e.Runtime("rack"); ok {
+		t.Errorf("runtime %s with no load", runtime)
+	}
+	if _, ok := e.Runtime("other"); ok {
+		t.Error("runtime of an unknown device")
+	}
+	var disabled *Estimator
+	if _, ok := disabled.Runtime("rack"); ok {
+		t.Error("runtime from a disabled estimator")
+	}
+}
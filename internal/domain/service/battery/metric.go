@@ -0,0 +1,12 @@
+package battery
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var UPSBatteryRuntime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "battery_runtime_seconds",
+	Help:      "Estimated time the battery powers the current load",
+}, []string{"device"})
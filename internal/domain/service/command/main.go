@@ -0,0 +1,128 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"sort"
+	"sync"
+	"time"
+)
+
+const dateLayout = "02/01/2006 15:04:05"
+
+// Commander runs commands on the UPSes, from the CLI, the HTTP API or NUT
+// instant commands. Every result is sent as a notification.
+type Commander struct {
+	log          *logger.Logger
+	sink         notifier.NotificationSink
+	experimental bool
+
+	mu      sync.RWMutex
+	devices map[string]*smsups.SMSUps
+}
+
+func NewCommander(l *application.Application, sink notifier.NotificationSink) *Commander {
+	return &Commander{
+		log:          l.Log.With("job", "command"),
+		sink:         sink,
+		experimental: l.Config.GetCommandsConfig().Experimental,
+		devices:      make(map[string]*smsups.SMSUps),
+	}
+}
+
+// Add registers a logged in UPS.
+func (c *Commander) Add(s *smsups.SMSUps) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices[s.Name()] = s
+}
+
+// Devices returns the names of the registered UPSes, sorted.
+func (c *Commander) Devices() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.devices))
+	for name := range c.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supported returns the commands that may be run, the experimental ones only
+// when enabled.
+func (c *Commander) Supported() []smsups.Command {
+	return smsups.Commands(c.experimental)
+}
+
+// Execute runs the command on the named UPS and notifies the result.
+func (c *Commander) Execute(ctx context.Context, name string, cmd smsups.Command, delay time.Duration) error {
+	c.mu.RLock()
+	sms, ok := c.devices[name]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown device %s", name)
+	}
+	if cmd.Experimental() && !c.experimental {
+		return fmt.Errorf("command %s is experimental, set commands.experimental to send it", cmd)
+	}
+	if delay < 0 || (delay > 0 && !cmd.Scheduled()) {
+		return fmt.Errorf("command %s does not accept a delay of %s", cmd, delay)
+	}
+
+	log := c.log.With("device", name)
+	log.Infof("running command %s (delay %s)", cmd, delay)
+
+	err := sms.SendCommand(ctx, cmd, delay)
+
+	notification := device.Notification{
+		Date:     time.Now().Format(dateLayout),
+		Device:   name,
+		Type:     device.EventCommand,
+		Severity: device.SeverityNotice,
+		Message:  fmt.Sprintf("command %s accepted", cmd),
+	}
+	if delay > 0 {
+		notification.Message = fmt.Sprintf("command %s scheduled in %s", cmd, delay)
+	}
+	if err != nil {
+		log.Errorf("command %s error: %s", cmd, err)
+		notification.Severity = device.SeverityError
+		notification.Message = err.Error()
+	}
+	if sendErr := c.sink.Send(ctx, notification); sendErr != nil {
+		log.Errorf("error sending command notification: %s", sendErr)
+	}
+	return err
+}
+
+// Commands returns the NUT instant commands of the UPS.
+func (c *Commander) Commands(ups string) []string {
+	c.mu.RLock()
+	_, ok := c.devices[ups]
+	c.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	for _, cmd := range c.Supported() {
+		names = append(names, string(cmd))
+	}
+	return names
+}
+
+// Run runs a NUT instant command at once.
+func (c *Commander) Run(ctx context.Context, ups, command string) error {
+	cmd, err := smsups.ParseCommand(command)
+	if err != nil {
+		return err
+	}
+	return c.Execute(ctx, ups, cmd, 0)
+}
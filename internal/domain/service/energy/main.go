@@ -0,0 +1,164 @@
+package energy
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// saveInterval is how often the totals are written to the state dir, they
+// are written on close as well.
+const saveInterval = time.Minute
+
+// defaultGaps is how many polling intervals may be missed before the time
+// between two readings is no longer accounted, when no max gap is set.
+const defaultGaps = 3
+
+// Meter turns the load of every UPS with a rating into watts, and integrates
+// them over time into the energy each one delivered. Totals are kept in the
+// state dir across restarts.
+type Meter struct {
+	log    *logger.Logger
+	path   string
+	rated  map[string]float64
+	maxGap map[string]time.Duration
+	mu     sync.Mutex
+	state  state
+	saved  time.Time
+}
+
+func NewMeter(l *application.Application) (*Meter, error) {
+	cfg := l.Config.GetEnergyConfig()
+	m := &Meter{
+		log:    l.Log.With("job", "energy"),
+		path:   filepath.Join(l.Config.GetStateDir(), stateFile),
+		rated:  make(map[string]float64),
+		maxGap: make(map[string]time.Duration),
+	}
+	s, err := loadState(m.path)
+	if err != nil {
+		return nil, err
+	}
+	m.state = s
+
+	for _, d := range l.Config.GetDevices() {
+		if d.Rating.Watts == 0 {
+			m.log.Warnf("device %s has no rating, its energy is not accounted", d.Name)
+			continue
+		}
+		m.rated[d.Name] = d.Rating.Watts
+		m.maxGap[d.Name] = cfg.MaxGap
+		if cfg.MaxGap == 0 {
+			m.maxGap[d.Name] = defaultGaps * d.Interval
+		}
+		if a, ok := m.state.Devices[d.Name]; ok {
+			UPSOutputEnergy.WithLabelValues(d.Name).Add(a.TotalWh)
+			m.export(d.Name, a, time.Now())
+		}
+	}
+	return m, nil
+}
+
+// Write accounts the energy delivered since the previous reading, taking the
+// power as changing linearly between them. Readings further apart than the
+// max gap are not accounted, since the load between them is unknown.
+func (m *Meter) Write(_ context.Context, reading device.Reading) error {
+	rated, ok := m.rated[reading.Device]
+	if !ok {
+		return nil
+	}
+	load, ok := reading.Value(device.QuantityLoad)
+	if !ok {
+		return nil
+	}
+	watts := rated * max(load, 0) / 100
+	UPSOutputPower.WithLabelValues(reading.Device).Set(watts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.state.Devices[reading.Device]
+	if !ok {
+		a = newAccount()
+		m.state.Devices[reading.Device] = a
+	}
+	elapsed := reading.GetAt.Sub(a.LastAt)
+	switch {
+	case a.LastAt.IsZero():
+	case elapsed <= 0:
+		return nil
+	case elapsed > m.maxGap[reading.Device]:
+		m.log.Warnf("no reading of %s for %s, energy not accounted", reading.Device, elapsed.Round(time.Second))
+	default:
+		wh := a.integrate(a.LastAt, a.LastWatts, reading.GetAt, watts)
+		UPSOutputEnergy.WithLabelValues(reading.Device).Add(wh)
+	}
+	a.LastAt = reading.GetAt
+	a.LastWatts = watts
+	m.export(reading.Device, a, reading.GetAt)
+
+	if time.Since(m.saved) < saveInterval {
+		return nil
+	}
+	return m.save()
+}
+
+// Close writes the totals to the state dir.
+func (m *Meter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+// Usage returns the energy delivered by every device with a rating.
+func (m *Meter) Usage() []device.EnergyUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var usage []device.EnergyUsage
+	for name := range m.rated {
+		u := device.EnergyUsage{
+			Device: name,
+			Days:   []device.EnergyTotal{},
+			Months: []device.EnergyTotal{},
+		}
+		if a, ok := m.state.Devices[name]; ok {
+			u.TotalWh = a.TotalWh
+			u.Watts = a.LastWatts
+			u.Days = totals(a.Days)
+			u.Months = totals(a.Months)
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Device < usage[j].Device
+	})
+	return usage
+}
+
+func (m *Meter) save() error {
+	m.saved = time.Now()
+	return saveState(m.path, m.state)
+}
+
+func (m *Meter) export(name string, a *account, at time.Time) {
+	UPSOutputEnergyPeriod.WithLabelValues(name, "day").Set(a.Days[at.Format(dayLayout)])
+	UPSOutputEnergyPeriod.WithLabelValues(name, "month").Set(a.Months[at.Format(monthLayout)])
+}
+
+// totals returns the periods newest first.
+func totals(periods map[string]float64) []device.EnergyTotal {
+	list := make([]device.EnergyTotal, 0, len(periods))
+	for period, wh := range periods {
+		list = append(list, device.EnergyTotal{Period: period, Wh: wh})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Period > list[j].Period
+	})
+	return list
+}
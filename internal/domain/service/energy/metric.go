@@ -0,0 +1,24 @@
+package energy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var UPSOutputPower = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "output_power_watts",
+	Help:      "Output power of the UPS, from its load and rating",
+}, []string{"device"})
+
+var UPSOutputEnergy = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ups",
+	Name:      "output_energy_wh_total",
+	Help:      "Energy delivered by the UPS since accounting started",
+}, []string{"device"})
+
+var UPSOutputEnergyPeriod = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "output_energy_wh",
+	Help:      "Energy delivered by the UPS in the current day or month",
+}, []string{"device", "period"})
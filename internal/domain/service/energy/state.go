@@ -0,0 +1,147 @@
+package energy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateFile = `energy.yaml`
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// the totals kept per device, older days and months are dropped
+const (
+	keepDays   = 400
+	keepMonths = 60
+)
+
+type state struct {
+	Devices map[string]*account `yaml:"devices"`
+}
+
+// account is the energy delivered by a device. The last reading is kept too,
+// so a restart shorter than the max gap is still accounted.
+type account struct {
+	TotalWh   float64            `yaml:"total_wh"`
+	LastAt    time.Time          `yaml:"last_at,omitempty"`
+	LastWatts float64            `yaml:"last_watts"`
+	Days      map[string]float64 `yaml:"days"`
+	Months    map[string]float64 `yaml:"months"`
+}
+
+func newAccount() *account {
+	return &account{
+		Days:   map[string]float64{},
+		Months: map[string]float64{},
+	}
+}
+
+// integrate accounts the energy delivered between two readings, taking the
+// power as changing linearly between them. The time between them is split at
+// midnight, so every day and month gets the energy delivered in it. It
+// returns the energy of the whole time.
+func (a *account) integrate(from time.Time, fromWatts float64, to time.Time, toWatts float64) float64 {
+	from = from.In(to.Location())
+	elapsed := to.Sub(from)
+	watts := func(at time.Time) float64 {
+		return fromWatts + (toWatts-fromWatts)*float64(at.Sub(from))/float64(elapsed)
+	}
+
+	var total float64
+	for start := from; start.Before(to); {
+		y, m, d := start.Date()
+		end := time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+		if end.After(to) {
+			end = to
+		}
+		wh := (watts(start) + watts(end)) / 2 * end.Sub(start).Hours()
+		a.add(start, wh)
+		total += wh
+		start = end
+	}
+	return total
+}
+
+// add accounts energy in the day and month of at.
+func (a *account) add(at time.Time, wh float64) {
+	day, month := at.Format(dayLayout), at.Format(monthLayout)
+	if _, ok := a.Days[day]; !ok {
+		a.prune(at)
+	}
+	a.TotalWh += wh
+	a.Days[day] += wh
+	a.Months[month] += wh
+}
+
+func (a *account) prune(at time.Time) {
+	// the layouts sort as the dates do
+	days := at.AddDate(0, 0, -keepDays).Format(dayLayout)
+	for day := range a.Days {
+		if day < days {
+			delete(a.Days, day)
+		}
+	}
+	months := at.AddDate(0, -keepMonths, 0).Format(monthLayout)
+	for month := range a.Months {
+		if month < months {
+			delete(a.Months, month)
+		}
+	}
+}
+
+func loadState(path string) (state, error) {
+	s := state{Devices: map[string]*account{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading %s: %w", path, err)
+	}
+	err = yaml.Unmarshal(data, &s)
+	if err != nil {
+		return s, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Devices == nil {
+		s.Devices = map[string]*account{}
+	}
+	for name, a := range s.Devices {
+		if a == nil {
+			delete(s.Devices, name)
+			continue
+		}
+		if a.Days == nil {
+			a.Days = map[string]float64{}
+		}
+		if a.Months == nil {
+			a.Months = map[string]float64{}
+		}
+	}
+	return s, nil
+}
+
+func saveState(path string, s state) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(path, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package energy
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIntegrateSplitsAtMidnight(t *testing.T) {
+	from := time.Date(2026, 1, 31, 23, 30, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	a := newAccount()
+	total := a.integrate(from, 0, to, 200)
+
+	// the power ramps from 0 to 200W, so the first half hour delivers 25Wh
+	// and the second 75Wh
+	want := map[string]float64{
+		"2026-01-31": 25,
+		"2026-02-01": 75,
+	}
+	if !near(total, 100) {
+		t.Errorf("total %v Wh, want 100", total)
+	}
+	for day, wh := range want {
+		if !near(a.Days[day], wh) {
+			t.Errorf("day %s has %v Wh, want %v", day, a.Days[day], wh)
+		}
+	}
+	if !near(a.Months["2026-01"], 25) || !near(a.Months["2026-02"], 75) {
+		t.Errorf("months %v, want 25 Wh in 2026-01 and 75 Wh in 2026-02", a.Months)
+	}
+	if !near(a.TotalWh, 100) {
+		t.Errorf("account total %v Wh, want 100", a.TotalWh)
+	}
+}
+
+func TestIntegrateWithinDay(t *testing.T) {
+	from := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	a := newAccount()
+	total := a.integrate(from, 100, from.Add(30*time.Minute), 100)
+	if !near(total, 50) || !near(a.Days["2026-03-10"], 50) || len(a.Days) != 1 {
+		t.Errorf("total %v Wh, days %v, want 50 Wh in 2026-03-10", total, a.Days)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
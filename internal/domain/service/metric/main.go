@@ -2,14 +2,22 @@ package metric
 
 import (
 	"context"
-	"fmt"
 	"github.com/alexwbaule/ups-metrics/internal/application"
 	"github.com/alexwbaule/ups-metrics/internal/application/config"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/alert"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/battery"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/energy"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/outage"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/shutdown"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
 	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
 	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/buffer"
 	"github.com/alexwbaule/ups-metrics/internal/resource/writer/influxdb"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/mqtt"
 	"github.com/alexwbaule/ups-metrics/internal/resource/writer/prometheus"
 	"time"
 )
@@ -17,34 +25,89 @@ import (
 type GetMetric struct {
 	log *logger.Logger
 	*config.Config
-	sms *smsups.SMSUps
+	sms    *smsups.SMSUps
+	writer writer.WriteMetric
 }
 
-func NewMetric(l *application.Application, s *smsups.SMSUps) *GetMetric {
+// NewWriter builds the writer shared by every device, fanning out to all
+// enabled metric sinks. Alerts and the shutdown controller are fed as more
+// sinks, sending their notifications to sink, and store always keeps the
+// last metric of each device. meter, when not nil, accounts the energy, and
+// estimator, when not nil, estimates the battery runtime for the alerts and
+// the shutdown controller. tracker, when not nil, keeps the outages.
+func NewWriter(l *application.Application, sink notifier.NotificationSink, store *latest.Store, meter *energy.Meter, estimator *battery.Estimator, tracker *outage.Tracker) (*writer.Multi, error) {
+	multi := writer.NewMulti(l.Log)
+	multi.Add("latest", store)
+
+	if l.Config.GetMetricConfig().Prometheus.Enabled {
+		l.Log.Infof("Starting Prometheus metrics collection")
+		multi.Add("prometheus", prometheus.NewWorker(l.Log, l.Config))
+	}
+	if l.Config.GetMetricConfig().Influx.Enabled {
+		l.Log.Infof("Starting InfluxDB metrics collection")
+		w, err := buffered(l, "influxdb", influxdb.NewWorker(l.Log, l.Config))
+		if err != nil {
+			return nil, err
+		}
+		multi.Add("influxdb", w)
+	}
+	if l.Config.GetMetricConfig().Mqtt.Enabled {
+		l.Log.Infof("Starting MQTT publisher")
+		multi.Add("mqtt", mqtt.NewWorker(l.Log, l.Config))
+	}
+	if l.Config.GetAlertsConfig().Enabled {
+		l.Log.Infof("Starting alerts evaluation")
+		a, err := alert.NewAlert(l, sink, estimator)
+		if err != nil {
+			return nil, err
+		}
+		multi.Add("alerts", a)
+	}
+	if l.Config.GetShutdownConfig().Enabled {
+		l.Log.Infof("Starting shutdown controller")
+		multi.Add("shutdown", shutdown.NewShutdown(l, sink, estimator))
+	}
+	if meter != nil {
+		l.Log.Infof("Starting energy accounting")
+		multi.Add("energy", meter)
+	}
+	if estimator != nil {
+		l.Log.Infof("Starting battery runtime estimation")
+		multi.Add("battery_runtime", estimator)
+	}
+	if tracker != nil {
+		l.Log.Infof("Starting outage tracking")
+		multi.Add("outages", tracker)
+	}
+	if !l.Config.GetMetricConfig().Prometheus.Enabled && !l.Config.GetMetricConfig().Influx.Enabled && !l.Config.GetMetricConfig().Mqtt.Enabled {
+		l.Log.Warnf("no metric configuration found, metrics will not be exported")
+	}
+	return multi, nil
+}
+
+// buffered keeps the metrics a remote sink failed to write on disk, to be
+// replayed once it recovers, when the buffer is enabled.
+func buffered(l *application.Application, name string, w writer.WriteMetric) (writer.WriteMetric, error) {
+	cfg := l.Config.GetMetricConfig().Buffer
+	if !cfg.Enabled {
+		return w, nil
+	}
+	return buffer.NewBuffer(l.Log, name, w, cfg)
+}
+
+func NewMetric(l *application.Application, s *smsups.SMSUps, w writer.WriteMetric) *GetMetric {
 	return &GetMetric{
-		log:    l.Log,
+		log:    l.Log.With("device", s.Name()),
 		Config: l.Config,
 		sms:    s,
+		writer: w,
 	}
 }
 
 func (g *GetMetric) Run(ctx context.Context) error {
-	ticker := time.NewTicker(g.Config.GetInterval())
-	var metricWriter writer.WriteMetric
-
+	ticker := time.NewTicker(g.sms.Interval())
 	defer ticker.Stop()
 
-	if g.Config.GetMetricConfig().Prometheus.Enabled {
-		g.log.Infof("Starting Prometheus metrics collection")
-		metricWriter = prometheus.NewWorker(g.log, g.Config)
-	} else if g.Config.GetMetricConfig().Influx.Enabled {
-		g.log.Infof("Starting InfluxDB metrics collection")
-		metricWriter = influxdb.NewWorker(g.log, g.Config)
-	} else {
-		e := fmt.Errorf("no metric configuration found")
-		return e
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -52,19 +115,19 @@ func (g *GetMetric) Run(ctx context.Context) error {
 			return context.Canceled
 		case <-ticker.C:
 		}
-		metric, err := g.getStats(ctx)
+		reading, err := g.getStats(ctx)
 		if err != nil {
 			g.log.Errorf("get metric error: %s (will retry on next tick)", err)
 			continue // Não retorna erro, apenas continua no próximo tick
 		}
-		err = metricWriter.Write(ctx, metric)
+		err = g.writer.Write(ctx, reading)
 		if err != nil {
-			g.log.Errorf("writing metric error: %s (will retry on next tick)", err)
+			g.log.Errorf("writing metric error: %s (the reading is lost for those sinks)", err)
 			continue // Não retorna erro, apenas continua no próximo tick
 		}
 	}
 }
 
-func (g *GetMetric) getStats(ctx context.Context) (device.Metric, error) {
+func (g *GetMetric) getStats(ctx context.Context) (device.Reading, error) {
 	return g.sms.GetMeasurements(ctx)
 }
@@ -0,0 +1,166 @@
+package metric_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/metric"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// influx is a fake InfluxDB v1 write endpoint, failing every write while
+// down is set.
+type influx struct {
+	mu     sync.Mutex
+	down   bool
+	writes []string
+}
+
+func (f *influx) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	f.writes = append(f.writes, string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *influx) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *influx) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.writes)
+}
+
+func (f *influx) last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.writes) == 0 {
+		return ""
+	}
+	return f.writes[len(f.writes)-1]
+}
+
+// eventually fails the test when cond is still false after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCollectorWriters(t *testing.T) {
+	db := &influx{}
+	server := httptest.NewServer(db)
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	fake, app := smsupstest.NewApplication(t, fmt.Sprintf(`metrics:
+  prometheus:
+    enabled: true
+  influxdb:
+    enabled: true
+    address: %s
+    port: "%s"
+    database: ups
+  buffer:
+    enabled: true
+`, host, port))
+
+	d := app.Config.GetDevices()[0]
+	sms, err := smsups.MewSMSUPS(app, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := latest.NewStore()
+	w, err := metric.NewWriter(app, notifier.NewMulti(app.Log), store, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	go metric.NewMetric(app, sms, w).Run(ctx)
+
+	eventually(t, "the first write to influxdb", func() bool {
+		return strings.Contains(db.last(), "input_voltage,device=rack")
+	})
+	eventually(t, "the prometheus series", func() bool {
+		return gauge(t, "ups_up", "rack") == 1
+	})
+
+	fake.PowerLoss()
+	eventually(t, "the reading on battery", func() bool {
+		reading, ok := store.Get("rack")
+		on, reported := reading.Statuses[device.StatusOnGrid]
+		return ok && reported && !on
+	})
+
+	// readings collected while influxdb is down are buffered and replayed
+	// once it is back
+	buffer := filepath.Join(app.Config.GetStateDir(), "buffer", "influxdb")
+	db.setDown(true)
+	eventually(t, "buffered readings", func() bool {
+		return pending(buffer) >= 2
+	})
+	db.setDown(false)
+	before := db.count()
+	eventually(t, "the buffer to drain", func() bool {
+		return pending(buffer) == 0 && db.count() > before+1
+	})
+}
+
+func pending(dir string) int {
+	entries, _ := os.ReadDir(dir)
+	return len(entries)
+}
+
+// gauge returns the value of the named gauge of a device from the default
+// registry, or -1 when it is not there.
+func gauge(t *testing.T, name, device string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "device" && label.GetValue() == device {
+					return m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return -1
+}
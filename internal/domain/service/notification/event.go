@@ -0,0 +1,70 @@
+package notification
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"strings"
+)
+
+type eventRule struct {
+	contains []string
+	any      []string
+	event    device.EventType
+	severity device.Severity
+}
+
+// eventRules are matched in order against the message without accents and in
+// lower case: every word of contains and at least one of any (when set) must be
+// present. Restoring rules come first, since their messages usually mention
+// the failure too.
+var eventRules = []eventRule{
+	{contains: []string{"rede"}, any: []string{"retorno", "restabelecid", "normaliz", "volta", "restaurad"}, event: device.EventPowerRestored, severity: device.SeverityNotice},
+	{contains: []string{"energia"}, any: []string{"retorno", "restabelecid", "normaliz", "volta", "restaurad"}, event: device.EventPowerRestored, severity: device.SeverityNotice},
+	{contains: []string{"teste"}, any: []string{"fim", "final", "conclu", "termin", "encerrad"}, event: device.EventTestFinished, severity: device.SeverityNotice},
+	{contains: []string{"teste"}, event: device.EventTestStarted, severity: device.SeverityNotice},
+	{contains: []string{"bateria"}, any: []string{"baixa", "baixo", "critic", "descarregad"}, event: device.EventBatteryLow, severity: device.SeverityCritical},
+	{contains: []string{"bateria"}, any: []string{"falha", "defeito", "substitu", "troca", "ruim"}, event: device.EventBatteryFault, severity: device.SeverityCritical},
+	{contains: []string{"rede"}, any: []string{"falha", "queda", "falta", "sem ", "ausencia"}, event: device.EventPowerFailure, severity: device.SeverityWarning},
+	{contains: []string{"energia"}, any: []string{"falha", "queda", "falta", "sem ", "ausencia"}, event: device.EventPowerFailure, severity: device.SeverityWarning},
+	{any: []string{"sobrecarga", "potencia elevada", "overload"}, event: device.EventOverload, severity: device.SeverityError},
+	{any: []string{"sobretemperatura", "superaquec", "temperatura elevada", "temperatura alta"}, event: device.EventOverTemperature, severity: device.SeverityError},
+	{any: []string{"desligamento", "desligado", "desligando", "shutdown"}, event: device.EventShutdown, severity: device.SeverityCritical},
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ü", "u",
+	"ç", "c",
+)
+
+// Classify maps a firmware message to an event type and severity. Unknown
+// messages are informational.
+func Classify(message string) (device.EventType, device.Severity) {
+	text := accents.Replace(strings.ToLower(message))
+
+	for _, rule := range eventRules {
+		if matches(text, rule) {
+			return rule.event, rule.severity
+		}
+	}
+	return device.EventUnknown, device.SeverityInformational
+}
+
+func matches(text string, rule eventRule) bool {
+	for _, word := range rule.contains {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	if len(rule.any) == 0 {
+		return true
+	}
+	for _, word := range rule.any {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
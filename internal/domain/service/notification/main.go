@@ -2,34 +2,85 @@ package notification
 
 import (
 	"context"
+	"fmt"
 	"github.com/alexwbaule/ups-metrics/internal/application"
 	"github.com/alexwbaule/ups-metrics/internal/application/config"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
-	"github.com/alexwbaule/ups-metrics/internal/resource/graylog"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/email"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/graylog"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/ntfy"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/slack"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/telegram"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/webhook"
 	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"strings"
 	"time"
 )
 
 type GetNotification struct {
 	log *logger.Logger
 	*config.Config
-	sms     *smsups.SMSUps
-	graylog *graylog.Gelf
-	last    int
+	name  string
+	sms   *smsups.SMSUps
+	sink  *notifier.Multi
+	last  int
+	known bool
 }
 
-func NewGetNotification(l *application.Application, s *smsups.SMSUps) *GetNotification {
-	return &GetNotification{
-		log:     l.Log,
-		Config:  l.Config,
-		sms:     s,
-		last:    l.Config.GetLastKnowId(),
-		graylog: graylog.NewGelf(l),
+// NewSink builds the sink shared by every device, delivering to all enabled
+// notification outputs. Graylog is enabled whenever its address is set, and
+// history always keeps the last notifications of each device.
+func NewSink(l *application.Application, history *history.History) (*notifier.Multi, error) {
+	multi := notifier.NewMulti(l.Log)
+	httpClient := l.Config.GetHttpClient()
+	cfg := l.Config.GetNotifiersConfig()
+
+	if l.Config.GetGelfConfig().Address != "" {
+		multi.Add("graylog", graylog.NewSink(l.Log, l.Config.GetGelfConfig()))
+	}
+	if cfg.Webhook.Enabled {
+		multi.Add("webhook", webhook.NewSink(l.Log, httpClient, cfg.Webhook))
+	}
+	if cfg.Slack.Enabled {
+		multi.Add("slack", slack.NewSink(l.Log, httpClient, cfg.Slack))
+	}
+	if cfg.Telegram.Enabled {
+		multi.Add("telegram", telegram.NewSink(l.Log, httpClient, cfg.Telegram))
+	}
+	if cfg.Ntfy.Enabled {
+		multi.Add("ntfy", ntfy.NewSink(l.Log, httpClient, cfg.Ntfy))
+	}
+	if cfg.Email.Enabled {
+		multi.Add("email", email.NewSink(l.Log, cfg.Email))
+	}
+	if multi.Len() == 0 {
+		l.Log.Warnf("no notification configuration found, notifications will not be delivered")
+	}
+	multi.Add("history", history)
+	return multi, nil
+}
+
+func NewGetNotification(l *application.Application, d device.Device, s *smsups.SMSUps, sink *notifier.Multi) (*GetNotification, error) {
+	last, known, err := l.Config.GetLastKnowId(d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading last notification id: %w", err)
 	}
+	return &GetNotification{
+		log:    l.Log.With("device", d.Name),
+		Config: l.Config,
+		name:   d.Name,
+		sms:    s,
+		last:   last,
+		known:  known,
+		sink:   sink,
+	}, nil
 }
 
 func (g *GetNotification) Run(ctx context.Context) error {
-	ticker := time.NewTicker(g.Config.GetInterval())
+	ticker := time.NewTicker(g.sms.Interval())
 	defer ticker.Stop()
 
 	for {
@@ -52,21 +103,49 @@ func (g *GetNotification) getStats(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	g.log.Infof("sending notifications bigger than %d to %s for hostname %s", g.last, g.graylog.Address, g.graylog.Hostname)
+
+	if !g.known {
+		// first run for this device, skip the history kept by the UPS
+		for _, notification := range n.Notifications {
+			g.last = max(g.last, notification.ID)
+		}
+		g.log.Infof("no notification id saved, starting after id %d", g.last)
+		g.known = true
+		return g.save()
+	}
+
+	g.log.Infof("sending notifications bigger than %d to %s", g.last, strings.Join(g.sink.Names(), ", "))
 
 	s := len(n.Notifications) - 1
 
 	for i := s; i >= 0; i-- {
 		notification := n.Notifications[i]
 		if notification.ID > g.last {
-			g.log.Infof("sending notifications id: %d", notification.ID)
-			g.graylog.LogNotifications(notification)
+			notification.Type, notification.Severity = Classify(notification.Message)
+			g.log.Infof("sending notifications id: %d (%s)", notification.ID, notification.Type)
+			err = g.sink.Send(ctx, notification)
+			if err != nil {
+				return fmt.Errorf("sending notification %d: %w", notification.ID, err)
+			}
+			UPSEvents.WithLabelValues(g.name, string(notification.Type)).Inc()
 			g.last = notification.ID
+			err = g.save()
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+func (g *GetNotification) save() error {
+	err := g.Config.SaveLastId(g.name, g.last)
+	if err != nil {
+		return fmt.Errorf("saving last notification id %d: %w", g.last, err)
+	}
+	return nil
+}
+
 func (g *GetNotification) LastId() int {
 	return g.last
 }
@@ -0,0 +1,123 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/notification"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type payload struct {
+	Device  string `json:"device"`
+	ID      int    `json:"id"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// webhook keeps the notifications posted to it.
+type webhook struct {
+	mu       sync.Mutex
+	received []payload
+}
+
+func (f *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var p payload
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.received = append(f.received, p)
+}
+
+func (f *webhook) payloads() []payload {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]payload(nil), f.received...)
+}
+
+// eventually fails the test when cond is still false after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	hook := &webhook{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	fake, app := smsupstest.NewApplication(t, fmt.Sprintf(`notifications:
+  webhook:
+    enabled: true
+    url: %s
+`, server.URL))
+
+	// kept by the UPS before the first run, so never sent
+	fake.Notify(smsupstest.MessageTestStarted)
+
+	d := app.Config.GetDevices()[0]
+	sms, err := smsups.MewSMSUPS(app, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := notification.NewSink(app, history.NewHistory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := notification.NewGetNotification(app, d, sms, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go job.Run(ctx)
+
+	cursor := func() int {
+		id, _, err := app.Config.GetLastKnowId(d.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	eventually(t, "the history to be skipped", func() bool {
+		return cursor() == 1
+	})
+
+	fake.PowerLoss()
+	fake.PowerRestore()
+	eventually(t, "the notifications to be sent", func() bool {
+		return cursor() == 3
+	})
+
+	got := hook.payloads()
+	want := []payload{
+		{Device: "rack", ID: 2, Message: smsupstest.MessagePowerFailure, Type: "power_failure"},
+		{Device: "rack", ID: 3, Message: smsupstest.MessagePowerRestored, Type: "power_restored"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("notification %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
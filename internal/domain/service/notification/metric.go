@@ -0,0 +1,12 @@
+package notification
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var UPSEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ups",
+	Name:      "events_total",
+	Help:      "The number of notifications delivered for each event type",
+}, []string{"device", "type"})
@@ -0,0 +1,180 @@
+package outage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const historyFile = `outages.yaml`
+
+const dayLayout = "2006-01-02"
+
+// maxDays bounds the days of a report.
+const maxDays = 3660
+
+type episode struct {
+	Device     string    `yaml:"device"`
+	Start      time.Time `yaml:"start"`
+	End        time.Time `yaml:"end,omitempty"`
+	MinBattery float64   `yaml:"min_battery"`
+	MaxLoad    float64   `yaml:"max_load"`
+	Readings   int       `yaml:"readings"`
+}
+
+// History is the outages of every device, in the order they started.
+type History struct {
+	Outages []*episode `yaml:"outages"`
+}
+
+// ReadHistory reads the outages kept in the state dir, none when the file
+// does not exist yet.
+func ReadHistory(dir string) (*History, error) {
+	path := filepath.Join(dir, historyFile)
+	h := &History{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	err = yaml.Unmarshal(data, h)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	valid := h.Outages[:0]
+	for _, e := range h.Outages {
+		if e != nil {
+			valid = append(valid, e)
+		}
+	}
+	h.Outages = valid
+	return h, nil
+}
+
+func (h *History) save(path string) error {
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteFileAtomic(path, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// last returns the newest outage of the device and the one before it, nil
+// when there are none.
+func (h *History) last(name string) (last *episode, previous *episode) {
+	for i := len(h.Outages) - 1; i >= 0; i-- {
+		if h.Outages[i].Device != name {
+			continue
+		}
+		if last != nil {
+			return last, h.Outages[i]
+		}
+		last = h.Outages[i]
+	}
+	return last, nil
+}
+
+// prune drops the outages that ended before the time.
+func (h *History) prune(before time.Time) {
+	kept := h.Outages[:0]
+	for _, e := range h.Outages {
+		if e.End.IsZero() || !e.End.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	h.Outages = kept
+}
+
+// Report returns the outages of the device, or of every device when name is
+// empty, in the last days up to now. Outages still going on last until now.
+func (h *History) Report(name string, days int, now time.Time) device.OutageReport {
+	days = min(max(days, 1), maxDays)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, 1-days)
+
+	report := device.OutageReport{
+		Outages: []device.Outage{},
+		Days:    make([]device.OutageDay, days),
+	}
+	for i := range report.Days {
+		report.Days[i].Date = today.AddDate(0, 0, -i).Format(dayLayout)
+	}
+
+	for _, e := range h.Outages {
+		if name != "" && e.Device != name {
+			continue
+		}
+		end := e.End
+		if end.IsZero() {
+			end = now
+		}
+		if end.Before(from) {
+			continue
+		}
+		report.Outages = append(report.Outages, e.outage(end))
+
+		for i := range report.Days {
+			start := today.AddDate(0, 0, -i)
+			next := start.AddDate(0, 0, 1)
+			if !e.Start.Before(start) && e.Start.Before(next) {
+				report.Days[i].Count++
+			}
+			overlap := earliest(end, next).Sub(latest(e.Start, start))
+			if overlap > 0 {
+				report.Days[i].Seconds += overlap.Seconds()
+			}
+		}
+	}
+	sort.Slice(report.Outages, func(i, j int) bool {
+		return report.Outages[i].Start.After(report.Outages[j].Start)
+	})
+	return report
+}
+
+func (e *episode) outage(end time.Time) device.Outage {
+	o := device.Outage{
+		Device:     e.Device,
+		Start:      e.Start,
+		Seconds:    end.Sub(e.Start).Seconds(),
+		MinBattery: e.MinBattery,
+		MaxLoad:    e.MaxLoad,
+		Readings:   e.Readings,
+	}
+	if !e.End.IsZero() {
+		end := e.End
+		o.End = &end
+	}
+	return o
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package outage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	h := &History{Outages: []*episode{
+		{Device: "rack", Start: at(time.February, 20, 10, 0), End: at(time.February, 20, 11, 0)},
+		// across the end of the month
+		{Device: "rack", Start: at(time.February, 29, 23, 0), End: at(time.March, 1, 1, 30), Readings: 3},
+		{Device: "other", Start: at(time.March, 1, 2, 0), End: at(time.March, 1, 2, 30)},
+		// still going on
+		{Device: "rack", Start: at(time.March, 1, 11, 0)},
+	}}
+	now := at(time.March, 1, 12, 0)
+
+	report := h.Report("rack", 3, now)
+	var starts []time.Time
+	for _, o := range report.Outages {
+		starts = append(starts, o.Start)
+	}
+	if want := []time.Time{at(time.March, 1, 11, 0), at(time.February, 29, 23, 0)}; !slices.Equal(starts, want) {
+		t.Fatalf("outages starting at %v, want %v", starts, want)
+	}
+	if o := report.Outages[0]; o.End != nil || o.Seconds != 3600 {
+		t.Errorf("ongoing outage ends at %v after %vs, want no end after 3600s", o.End, o.Seconds)
+	}
+	if o := report.Outages[1]; o.End == nil || o.Seconds != 9000 || o.Readings != 3 {
+		t.Errorf("outage %+v, want 9000s from 3 readings", o)
+	}
+
+	tests := []struct {
+		date    string
+		count   int
+		seconds float64
+	}{
+		{date: "2024-03-01", count: 1, seconds: 5400 + 3600},
+		{date: "2024-02-29", count: 1, seconds: 3600},
+		{date: "2024-02-28"},
+	}
+	if len(report.Days) != len(tests) {
+		t.Fatalf("%d days, want %d", len(report.Days), len(tests))
+	}
+	for i, tt := range tests {
+		d := report.Days[i]
+		if d.Date != tt.date || d.Count != tt.count || d.Seconds != tt.seconds {
+			t.Errorf("day %+v, want %s with %d outages for %vs", d, tt.date, tt.count, tt.seconds)
+		}
+	}
+
+	report = h.Report("", 1, now)
+	if len(report.Outages) != 3 || report.Days[0].Count != 2 || report.Days[0].Seconds != 5400+1800+3600 {
+		t.Errorf("every device: %d outages, day %+v; want 3 outages, 2 started today", len(report.Outages), report.Days[0])
+	}
+}
@@ -0,0 +1,193 @@
+package outage
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// saveInterval is how often an outage going on is written to the state dir,
+// outages are written as soon as they start and end.
+const saveInterval = time.Minute
+
+// Tracker detects the outages of every UPS from the grid state of its
+// readings and from its power failure and restore notifications, and keeps
+// them in the state dir.
+type Tracker struct {
+	log     *logger.Logger
+	path    string
+	maxAge  time.Duration
+	mu      sync.Mutex
+	history *History
+	saved   time.Time
+	closed  map[string]time.Time
+}
+
+func NewTracker(l *application.Application) (*Tracker, error) {
+	return newTracker(l.Log.With("job", "outages"), l.Config.GetStateDir(), l.Config.GetOutagesConfig().MaxAge)
+}
+
+func newTracker(log *logger.Logger, dir string, maxAge time.Duration) (*Tracker, error) {
+	h, err := ReadHistory(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{
+		log:     log,
+		path:    filepath.Join(dir, historyFile),
+		maxAge:  maxAge,
+		history: h,
+		closed:  make(map[string]time.Time),
+	}, nil
+}
+
+// Write starts an outage when a device is on battery, keeping its lowest
+// battery level and highest load, and ends it once the device is back on
+// grid. Readings taken before the last outage of the device ended are
+// ignored, a notification already told about them. So are the ones taken
+// before a power restored notification closed it: the UPS may still report
+// being on battery for a while after it sent the notification.
+func (t *Tracker) Write(_ context.Context, reading device.Reading) error {
+	onGrid, ok := reading.Is(device.StatusOnGrid)
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if reading.GetAt.Before(t.closed[reading.Device]) {
+		return nil
+	}
+	last, _ := t.history.last(reading.Device)
+	if last != nil && (reading.GetAt.Before(last.Start) || (!last.End.IsZero() && !reading.GetAt.After(last.End))) {
+		return nil
+	}
+	var open *episode
+	if last != nil && last.End.IsZero() {
+		open = last
+	}
+
+	switch {
+	case !onGrid && open == nil:
+		observe(t.start(reading.Device, reading.GetAt), reading)
+		return t.save()
+	case !onGrid:
+		observe(open, reading)
+		if time.Since(t.saved) < saveInterval {
+			return nil
+		}
+		return t.save()
+	case open != nil:
+		t.finish(open, reading.GetAt)
+		return t.save()
+	}
+	return nil
+}
+
+// Send moves the start and end of the outages to the time the UPS told the
+// power failed and came back, which is earlier than the reading that saw it.
+// Outages too short for any reading to see are only known this way.
+func (t *Tracker) Send(_ context.Context, notification device.Notification) error {
+	if notification.Type != device.EventPowerFailure && notification.Type != device.EventPowerRestored {
+		return nil
+	}
+	at := notificationTime(notification)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, previous := t.history.last(notification.Device)
+	if notification.Type == device.EventPowerFailure {
+		switch {
+		case last == nil || (!last.End.IsZero() && at.After(last.End)):
+			t.start(notification.Device, at)
+		case at.Before(last.Start) && (previous == nil || at.After(previous.End)):
+			last.Start = at
+		default:
+			return nil
+		}
+		return t.save()
+	}
+
+	switch {
+	case last == nil || at.Before(last.Start):
+		return nil
+	case last.End.IsZero() || at.Before(last.End):
+		t.finish(last, at)
+		t.closed[notification.Device] = time.Now()
+	default:
+		return nil
+	}
+	return t.save()
+}
+
+// Outages returns the outages of the device, or of every device when name is
+// empty, in the last days.
+func (t *Tracker) Outages(name string, days int) device.OutageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.history.Report(name, days, time.Now())
+}
+
+// Close writes the outages to the state dir.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save()
+}
+
+func (t *Tracker) start(name string, at time.Time) *episode {
+	t.log.Infof("%s is on battery, outage started at %s", name, at.Format(time.DateTime))
+	t.history.prune(at.Add(-t.maxAge))
+
+	e := &episode{
+		Device: name,
+		Start:  at,
+	}
+	t.history.Outages = append(t.history.Outages, e)
+	return e
+}
+
+func (t *Tracker) finish(e *episode, at time.Time) {
+	e.End = at
+	t.log.Infof("%s is back on grid, outage lasted %s", e.Device, at.Sub(e.Start).Round(time.Second))
+}
+
+func (t *Tracker) save() error {
+	t.saved = time.Now()
+	return t.history.save(t.path)
+}
+
+func observe(e *episode, reading device.Reading) {
+	level, ok := reading.Value(device.QuantityBatteryLevel)
+	if !ok {
+		return
+	}
+	load, ok := reading.Value(device.QuantityLoad)
+	if !ok {
+		return
+	}
+	if e.Readings == 0 {
+		e.MinBattery = level
+		e.MaxLoad = load
+	}
+	e.MinBattery = min(e.MinBattery, level)
+	e.MaxLoad = max(e.MaxLoad, load)
+	e.Readings++
+}
+
+// notificationTime returns when the UPS sent the notification, or now when
+// its date is invalid or ahead of the local clock.
+func notificationTime(notification device.Notification) time.Time {
+	now := time.Now()
+	at, err := time.ParseInLocation("02/01/2006 15:04:05", notification.Date, time.Local)
+	if err != nil || at.After(now) {
+		return now
+	}
+	return at
+}
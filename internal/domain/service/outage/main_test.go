@@ -0,0 +1,90 @@
+package outage
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"testing"
+	"time"
+)
+
+func newTestTracker(t *testing.T) *Tracker {
+	t.Helper()
+	tr, err := newTracker(logger.NewLogger(), t.TempDir(), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func write(t *testing.T, tr *Tracker, at time.Time, onGrid bool) {
+	t.Helper()
+	err := tr.Write(context.Background(), device.Reading{
+		Device: "rack",
+		GetAt:  at,
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: 80},
+			device.QuantityLoad:         {Value: 30},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: onGrid,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func send(t *testing.T, tr *Tracker, at time.Time, event device.EventType) {
+	t.Helper()
+	err := tr.Send(context.Background(), device.Notification{
+		Device: "rack",
+		Date:   at.Format("02/01/2006 15:04:05"),
+		Type:   event,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutage(t *testing.T) {
+	tr := newTestTracker(t)
+	now := time.Now().Truncate(time.Second)
+
+	write(t, tr, now.Add(-10*time.Minute), false)
+	// the UPS tells the power failed before the reading saw it
+	send(t, tr, now.Add(-11*time.Minute), device.EventPowerFailure)
+	write(t, tr, now.Add(-9*time.Minute), false)
+	write(t, tr, now.Add(-5*time.Minute), true)
+
+	report := tr.Outages("rack", 2)
+	if len(report.Outages) != 1 {
+		t.Fatalf("%d outages, want 1", len(report.Outages))
+	}
+	o := report.Outages[0]
+	if !o.Start.Equal(now.Add(-11*time.Minute)) || o.End == nil || !o.End.Equal(now.Add(-5*time.Minute)) || o.Readings != 2 {
+		t.Errorf("outage %+v, want 6 minutes from the notification to the reading on grid", o)
+	}
+}
+
+func TestLaggingReading(t *testing.T) {
+	tr := newTestTracker(t)
+	now := time.Now().Truncate(time.Second)
+
+	write(t, tr, now.Add(-3*time.Minute), false)
+	send(t, tr, now.Add(-2*time.Minute), device.EventPowerRestored)
+	// read after the UPS restored the power, but before the notification
+	// told so, the UPS still reported being on battery
+	write(t, tr, now.Add(-time.Minute), false)
+
+	report := tr.Outages("rack", 2)
+	if len(report.Outages) != 1 || report.Outages[0].End == nil {
+		t.Fatalf("outages %+v, want the closed one only", report.Outages)
+	}
+
+	write(t, tr, time.Now().Add(time.Second), false)
+	report = tr.Outages("rack", 2)
+	if len(report.Outages) != 2 || report.Outages[0].End != nil {
+		t.Errorf("outages %+v, want a new one going on", report.Outages)
+	}
+}
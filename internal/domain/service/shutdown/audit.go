@@ -0,0 +1,63 @@
+package shutdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// audit appends one JSON line per shutdown step, synced to disk right away
+// since the host may go down at any moment.
+type audit struct {
+	path string
+	mu   sync.Mutex
+}
+
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Device  string    `json:"device"`
+	Event   string    `json:"event"`
+	Details string    `json:"details"`
+}
+
+func newAudit(path string) *audit {
+	return &audit{path: path}
+}
+
+func (a *audit) write(name, event, details string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var data bytes.Buffer
+
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(auditEntry{
+		Time:    time.Now(),
+		Device:  name,
+		Event:   event,
+		Details: details,
+	})
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(a.path), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
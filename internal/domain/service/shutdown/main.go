@@ -0,0 +1,287 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staleAfter is how old a reading may be to still be trusted to start or
+// cancel a shutdown.
+const staleAfter = time.Minute
+
+const dateLayout = "02/01/2006 15:04:05"
+
+// notifyTimeout bounds the delivery of each shutdown notification, since the
+// outputs are likely unreachable during an outage.
+const notifyTimeout = 10 * time.Second
+
+// notifyQueue is how many notifications may wait to be delivered, the newer
+// ones are dropped when it is full.
+const notifyQueue = 100
+
+// Shutdown watches the UPS readings and, once a device is on battery past the
+// configured limits, or stops reporting while on battery, runs the shutdown
+// commands after a grace period. The shutdown is cancelled if every watched
+// device is back on grid before the grace period ends. Notifications are
+// delivered in the background, so a slow output never holds the readings or
+// the commands.
+type Shutdown struct {
+	log       *logger.Logger
+	cfg       device.Shutdown
+	sink      notifier.NotificationSink
+	estimator device.RuntimeEstimator
+	audit     *audit
+	mu        sync.Mutex
+	onBattery map[string]time.Time
+	contact   map[string]*time.Timer
+	timer     *time.Timer
+	executed  bool
+	notices   chan device.Notification
+	done      chan struct{}
+}
+
+func NewShutdown(l *application.Application, sink notifier.NotificationSink, estimator device.RuntimeEstimator) *Shutdown {
+	return newShutdown(l.Log.With("job", "shutdown"), l.Config.GetShutdownConfig(), sink, estimator)
+}
+
+func newShutdown(l *logger.Logger, cfg device.Shutdown, sink notifier.NotificationSink, estimator device.RuntimeEstimator) *Shutdown {
+	s := &Shutdown{
+		log:       l,
+		cfg:       cfg,
+		sink:      sink,
+		estimator: estimator,
+		audit:     newAudit(cfg.AuditLog),
+		onBattery: make(map[string]time.Time),
+		contact:   make(map[string]*time.Timer),
+		notices:   make(chan device.Notification, notifyQueue),
+		done:      make(chan struct{}),
+	}
+	if sink != nil {
+		go s.deliver()
+	}
+	return s
+}
+
+func (s *Shutdown) Write(_ context.Context, reading device.Reading) error {
+	if len(s.cfg.Devices) > 0 && !slices.Contains(s.cfg.Devices, reading.Device) {
+		return nil
+	}
+	if time.Since(reading.GetAt) > staleAfter {
+		return nil
+	}
+	values := reading.Values()
+	onGrid, ok := values["on_grid"]
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if onGrid == 1 {
+		s.stopContact(reading.Device)
+		delete(s.onBattery, reading.Device)
+		if len(s.onBattery) == 0 {
+			s.cancel(reading.Device)
+		}
+		return nil
+	}
+
+	since, ok := s.onBattery[reading.Device]
+	if !ok {
+		since = reading.GetAt
+		s.onBattery[reading.Device] = since
+		s.trace(reading.Device, "on_battery", "running on battery")
+	}
+	s.watchContact(reading.Device)
+	if s.timer != nil || s.executed {
+		return nil
+	}
+
+	reason := s.reason(reading.Device, values, reading.GetAt.Sub(since))
+	if reason == "" {
+		return nil
+	}
+	s.schedule(reading.Device, reason)
+	return nil
+}
+
+// Close stops delivering the notifications.
+func (s *Shutdown) Close() error {
+	close(s.done)
+	return nil
+}
+
+// reason returns why the host must be shut down, or "" when it must not.
+func (s *Shutdown) reason(name string, values map[string]float64, onBattery time.Duration) string {
+	if level, ok := values["battery_level"]; ok && s.cfg.BatteryLevel > 0 && level <= s.cfg.BatteryLevel {
+		return fmt.Sprintf("battery level %.0f%% <= %.0f%%", level, s.cfg.BatteryLevel)
+	}
+	if s.estimator != nil && s.cfg.Runtime > 0 {
+		if runtime, ok := s.estimator.Runtime(name); ok && runtime <= s.cfg.Runtime {
+			return fmt.Sprintf("estimated runtime %s <= %s", runtime.Round(time.Second), s.cfg.Runtime)
+		}
+	}
+	if s.cfg.OnBatteryFor > 0 && onBattery >= s.cfg.OnBatteryFor {
+		return fmt.Sprintf("on battery for %s >= %s", onBattery.Round(time.Second), s.cfg.OnBatteryFor)
+	}
+	return ""
+}
+
+// schedule starts the grace period. It must be called with the lock held.
+func (s *Shutdown) schedule(name, reason string) {
+	s.record(name, "scheduled", device.EventShutdownScheduled, fmt.Sprintf("%s, shutting down in %s", reason, s.cfg.GracePeriod))
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.cfg.GracePeriod, func() {
+		s.mu.Lock()
+		if s.timer != timer {
+			// cancelled, and maybe scheduled again, while waiting for the lock
+			s.mu.Unlock()
+			return
+		}
+		s.timer = nil
+		s.executed = true
+		s.mu.Unlock()
+
+		s.execute(name)
+	})
+	s.timer = timer
+}
+
+// watchContact schedules the shutdown when no fresh reading of the device
+// comes within the lost contact time while it is on battery, since the UPS
+// may stop answering before its battery runs out, like when the wifi is down.
+func (s *Shutdown) watchContact(name string) {
+	if t, ok := s.contact[name]; ok {
+		t.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(s.cfg.LostContact, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.contact[name] != timer {
+			return
+		}
+		delete(s.contact, name)
+		if s.timer != nil || s.executed {
+			return
+		}
+		s.schedule(name, fmt.Sprintf("no reading for %s while on battery", s.cfg.LostContact))
+	})
+	s.contact[name] = timer
+}
+
+func (s *Shutdown) stopContact(name string) {
+	if t, ok := s.contact[name]; ok {
+		t.Stop()
+		delete(s.contact, name)
+	}
+}
+
+func (s *Shutdown) cancel(name string) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+		s.record(name, "cancelled", device.EventShutdownCancelled, "power restored, shutdown cancelled")
+	}
+	if s.executed {
+		s.executed = false
+		s.record(name, "rearmed", device.EventShutdownCancelled, "power restored after shutdown")
+	}
+}
+
+// execute runs every command in order, even when one of them fails, since
+// each usually shuts down a different host. The steps are notified once every
+// command ran.
+func (s *Shutdown) execute(name string) {
+	steps := []device.Notification{
+		s.step(name, "executing", device.EventShutdown, fmt.Sprintf("running %d shutdown commands", len(s.cfg.Commands))),
+	}
+	for _, c := range s.cfg.Commands {
+		line := strings.Join(append([]string{c.Command}, c.Args...), " ")
+		if s.cfg.DryRun {
+			steps = append(steps, s.step(name, "dry_run", device.EventShutdown, line))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		output, err := exec.CommandContext(ctx, c.Command, c.Args...).CombinedOutput()
+		cancel()
+
+		result := strings.TrimSpace(string(output))
+		if err != nil {
+			steps = append(steps, s.step(name, "command_failed", device.EventShutdown, fmt.Sprintf("%s: %s %s", line, err, result)))
+			continue
+		}
+		steps = append(steps, s.step(name, "command_done", device.EventShutdown, fmt.Sprintf("%s: %s", line, result)))
+	}
+	for _, n := range steps {
+		s.notify(n)
+	}
+}
+
+// trace writes the step to the audit log and the application log.
+func (s *Shutdown) trace(name, event, details string) {
+	s.log.Warnf("shutdown %s of %s: %s", event, name, details)
+
+	err := s.audit.write(name, event, details)
+	if err != nil {
+		s.log.Errorf("error writing shutdown audit log: %s", err)
+	}
+}
+
+// step traces the step and returns its notification.
+func (s *Shutdown) step(name, event string, kind device.EventType, details string) device.Notification {
+	s.trace(name, event, details)
+	return device.Notification{
+		Message:  fmt.Sprintf("shutdown %s: %s", event, details),
+		Date:     time.Now().Format(dateLayout),
+		Device:   name,
+		Type:     kind,
+		Severity: device.SeverityCritical,
+	}
+}
+
+// record traces the step and queues its notification.
+func (s *Shutdown) record(name, event string, kind device.EventType, details string) {
+	s.notify(s.step(name, event, kind, details))
+}
+
+// notify queues the notification without waiting, so it can be called with
+// the lock held.
+func (s *Shutdown) notify(n device.Notification) {
+	if s.sink == nil {
+		return
+	}
+	select {
+	case s.notices <- n:
+	default:
+		s.log.Errorf("shutdown notification queue is full, dropping %q", n.Message)
+	}
+}
+
+// deliver sends the queued notifications in order, until closed.
+func (s *Shutdown) deliver() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case n := <-s.notices:
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			err := s.sink.Send(ctx, n)
+			cancel()
+			if err != nil {
+				s.log.Errorf("error sending shutdown notification: %s", err)
+			}
+		}
+	}
+}
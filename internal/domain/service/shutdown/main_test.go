@@ -0,0 +1,263 @@
+package shutdown
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sink keeps the notifications it got. With block set, every Send waits for
+// it to be closed.
+type sink struct {
+	mu    sync.Mutex
+	sent  []device.Notification
+	block chan struct{}
+}
+
+func (s *sink) Send(ctx context.Context, n device.Notification) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+// steps returns the step of each notification, like "scheduled".
+func (s *sink) steps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var steps []string
+	for _, n := range s.sent {
+		step, _, _ := strings.Cut(strings.TrimPrefix(n.Message, "shutdown "), ":")
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func (s *sink) types() []device.EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []device.EventType
+	for _, n := range s.sent {
+		types = append(types, n.Type)
+	}
+	return types
+}
+
+// testConfig shuts down at 50% of battery after a short grace period, by
+// creating the returned file.
+func testConfig(t *testing.T) (device.Shutdown, string) {
+	t.Helper()
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "halted")
+	return device.Shutdown{
+		Enabled:      true,
+		BatteryLevel: 50,
+		LostContact:  time.Minute,
+		GracePeriod:  100 * time.Millisecond,
+		AuditLog:     filepath.Join(dir, "audit.log"),
+		Commands: []device.ShutdownCommand{
+			{Command: "touch", Args: []string{marker}, Timeout: 5 * time.Second},
+		},
+	}, marker
+}
+
+func newTestShutdown(t *testing.T, cfg device.Shutdown, s *sink) *Shutdown {
+	t.Helper()
+	sd := newShutdown(logger.NewLogger(), cfg, s, nil)
+	t.Cleanup(func() {
+		_ = sd.Close()
+	})
+	return sd
+}
+
+func reading(onGrid bool, level float64) device.Reading {
+	return device.Reading{
+		Device: "rack",
+		GetAt:  time.Now(),
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: level},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: onGrid,
+		},
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// eventually fails the test when cond is still false after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func write(t *testing.T, sd *Shutdown, r device.Reading) {
+	t.Helper()
+	err := sd.Write(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	cfg, marker := testConfig(t)
+	cfg.GracePeriod = 300 * time.Millisecond
+	s := &sink{}
+	sd := newTestShutdown(t, cfg, s)
+
+	write(t, sd, reading(false, 80))
+	write(t, sd, reading(false, 40))
+	time.Sleep(100 * time.Millisecond)
+	if exists(marker) {
+		t.Fatal("the commands ran before the grace period ended")
+	}
+	eventually(t, "the commands", func() bool {
+		return exists(marker)
+	})
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 3
+	})
+	if want := []string{"scheduled", "executing", "command_done"}; !slices.Equal(s.steps(), want) {
+		t.Errorf("steps %v, want %v", s.steps(), want)
+	}
+	want := []device.EventType{device.EventShutdownScheduled, device.EventShutdown, device.EventShutdown}
+	if !slices.Equal(s.types(), want) {
+		t.Errorf("types %v, want %v", s.types(), want)
+	}
+}
+
+func TestCancelOnPowerReturn(t *testing.T) {
+	cfg, marker := testConfig(t)
+	cfg.GracePeriod = 200 * time.Millisecond
+	s := &sink{}
+	sd := newTestShutdown(t, cfg, s)
+
+	write(t, sd, reading(false, 40))
+	write(t, sd, reading(true, 40))
+	time.Sleep(400 * time.Millisecond)
+	if exists(marker) {
+		t.Fatal("the commands ran after the power came back")
+	}
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 2
+	})
+	if want := []string{"scheduled", "cancelled"}; !slices.Equal(s.steps(), want) {
+		t.Errorf("steps %v, want %v", s.steps(), want)
+	}
+	if got := s.types()[1]; got != device.EventShutdownCancelled {
+		t.Errorf("cancel sent as %s", got)
+	}
+}
+
+func TestLostContact(t *testing.T) {
+	cfg, marker := testConfig(t)
+	cfg.BatteryLevel = 0
+	cfg.OnBatteryFor = time.Hour
+	cfg.LostContact = 100 * time.Millisecond
+	s := &sink{}
+	sd := newTestShutdown(t, cfg, s)
+
+	// on battery but far from any limit, then no more readings
+	write(t, sd, reading(false, 90))
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 3
+	})
+	if !exists(marker) {
+		t.Fatal("the commands did not run")
+	}
+	s.mu.Lock()
+	message := s.sent[0].Message
+	s.mu.Unlock()
+	if !strings.Contains(message, "no reading") {
+		t.Errorf("scheduled for %q, want the lost contact", message)
+	}
+}
+
+func TestRearm(t *testing.T) {
+	cfg, marker := testConfig(t)
+	s := &sink{}
+	sd := newTestShutdown(t, cfg, s)
+
+	write(t, sd, reading(false, 40))
+	eventually(t, "the first shutdown", func() bool {
+		return len(s.steps()) == 3
+	})
+	// a shutdown runs once per outage
+	write(t, sd, reading(false, 30))
+	err := os.Remove(marker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, sd, reading(true, 30))
+	write(t, sd, reading(false, 30))
+	eventually(t, "the second shutdown", func() bool {
+		return exists(marker)
+	})
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 7
+	})
+	want := []string{"scheduled", "executing", "command_done", "rearmed", "scheduled", "executing", "command_done"}
+	if !slices.Equal(s.steps(), want) {
+		t.Errorf("steps %v, want %v", s.steps(), want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cfg, marker := testConfig(t)
+	cfg.DryRun = true
+	s := &sink{}
+	sd := newTestShutdown(t, cfg, s)
+
+	write(t, sd, reading(false, 40))
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 3
+	})
+	if want := []string{"scheduled", "executing", "dry_run"}; !slices.Equal(s.steps(), want) {
+		t.Errorf("steps %v, want %v", s.steps(), want)
+	}
+	if exists(marker) {
+		t.Error("a dry run ran the commands")
+	}
+}
+
+func TestSlowSink(t *testing.T) {
+	cfg, marker := testConfig(t)
+	s := &sink{block: make(chan struct{})}
+	sd := newTestShutdown(t, cfg, s)
+
+	start := time.Now()
+	write(t, sd, reading(false, 40))
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("the reading waited %s for the notification", elapsed)
+	}
+	eventually(t, "the commands", func() bool {
+		return exists(marker)
+	})
+	close(s.block)
+	eventually(t, "the notifications", func() bool {
+		return len(s.steps()) == 3
+	})
+}
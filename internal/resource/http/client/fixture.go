@@ -0,0 +1,232 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const redacted = "REDACTED"
+
+// sensitive are the headers, query parameters and JSON fields redacted from
+// fixtures, compared in lower case.
+var sensitive = map[string]bool{
+	"token":         true,
+	"refreshtoken":  true,
+	"password":      true,
+	"authorization": true,
+}
+
+var sensitiveField = regexp.MustCompile(`(?i)("(?:token|refreshToken|password)"\s*:\s*)"[^"]*"`)
+
+// Fixture is a request and its response, as saved by Record and served by
+// Replay.
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+type FixtureRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type FixtureResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// Record saves every request and its response to dir, one JSON file each,
+// with tokens and passwords redacted. Files already in dir are kept.
+func (c *Client) Record(dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating fixture dir: %w", err)
+	}
+	names, err := fixtureFiles(dir)
+	if err != nil {
+		return err
+	}
+	seq := 0
+	for _, name := range names {
+		n, _ := strconv.Atoi(strings.SplitN(filepath.Base(name), "-", 2)[0])
+		seq = max(seq, n)
+	}
+	next := c.GetClient().Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.SetTransport(&recorder{log: c.log, next: next, dir: dir, seq: seq})
+	return nil
+}
+
+// Replay answers every request with the fixtures saved in dir instead of
+// sending it. Requests to the same method and path get their fixtures in the
+// order they were recorded, and the last one once they run out.
+func (c *Client) Replay(dir string) error {
+	names, err := fixtureFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no fixtures found in %s", dir)
+	}
+	r := &replayer{fixtures: make(map[string][]Fixture)}
+	for _, name := range names {
+		var fixture Fixture
+
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("reading fixture: %w", err)
+		}
+		err = json.Unmarshal(b, &fixture)
+		if err != nil {
+			return fmt.Errorf("decoding fixture %s: %w", name, err)
+		}
+		key := fixtureKey(fixture.Request.Method, fixture.Request.Path)
+		r.fixtures[key] = append(r.fixtures[key], fixture)
+	}
+	c.SetTransport(r)
+	return nil
+}
+
+type recorder struct {
+	log  *logger.Logger
+	next http.RoundTripper
+	dir  string
+	mu   sync.Mutex
+	seq  int
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{
+		Request: FixtureRequest{
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Query:   redactValues(req.URL.Query()),
+			Headers: redactValues(req.Header),
+		},
+		Response: FixtureResponse{
+			Status:  res.StatusCode,
+			Headers: redactValues(res.Header),
+			Body:    sensitiveField.ReplaceAllString(string(body), `$1"`+redacted+`"`),
+		},
+	}
+	err = r.save(fixture)
+	if err != nil {
+		r.log.Errorf("error recording fixture of %s %s: %s", req.Method, req.URL.Path, err)
+	}
+	return res, nil
+}
+
+func (r *recorder) save(fixture Fixture) error {
+	b, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	path := strings.Trim(strings.ReplaceAll(fixture.Request.Path, "/", "-"), "-")
+	name := filepath.Join(r.dir, fmt.Sprintf("%04d-%s-%s.json", r.seq, fixture.Request.Method, path))
+	return os.WriteFile(name, append(b, '\n'), 0o644)
+}
+
+type replayer struct {
+	mu       sync.Mutex
+	fixtures map[string][]Fixture
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	r.mu.Lock()
+	key := fixtureKey(req.Method, req.URL.Path)
+	fixtures := r.fixtures[key]
+	if len(fixtures) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no fixture for %s %s", req.Method, req.URL.Path)
+	}
+	fixture := fixtures[0]
+	if len(fixtures) > 1 {
+		r.fixtures[key] = fixtures[1:]
+	}
+	r.mu.Unlock()
+
+	header := make(http.Header, len(fixture.Response.Headers))
+	for k, v := range fixture.Response.Headers {
+		header.Set(k, v)
+	}
+	// the body may be shorter than recorded once redacted
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.Status, http.StatusText(fixture.Response.Status)),
+		StatusCode:    fixture.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Response.Body)),
+		ContentLength: int64(len(fixture.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func fixtureKey(method, path string) string {
+	return method + " " + path
+}
+
+func fixtureFiles(dir string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing fixtures: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// redactValues keeps the first value of each key, replacing the sensitive
+// ones.
+func redactValues(values map[string][]string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) == 0 {
+			continue
+		}
+		if sensitive[strings.ToLower(k)] {
+			out[k] = redacted
+			continue
+		}
+		out[k] = v[0]
+	}
+	return out
+}
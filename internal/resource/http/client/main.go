@@ -3,8 +3,8 @@ package client
 import (
 	"context"
 	"crypto/tls"
-	"github.com/alexwbaule/ups-metrics/internal/application/config"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 	"github.com/go-resty/resty/v2"
 	"net"
 	"net/http"
@@ -21,26 +21,40 @@ type Request struct {
 
 type Client struct {
 	*resty.Client
+	log *logger.Logger
 }
 
 type Response struct {
 	*resty.Response
 }
 
-func New(cfg *config.Config, baseUrl string, l *logger.Logger) *Client {
+// New returns a client verifying the server certificates.
+func New(cfg device.HttpClient, baseUrl string, l *logger.Logger) *Client {
+	return newClient(cfg, baseUrl, l, false)
+}
+
+// NewInsecure returns a client that accepts any server certificate. It is
+// only meant for the UPS, which serves a self-signed certificate.
+func NewInsecure(cfg device.HttpClient, baseUrl string, l *logger.Logger) *Client {
+	return newClient(cfg, baseUrl, l, true)
+}
+
+func newClient(cfg device.HttpClient, baseUrl string, l *logger.Logger, insecure bool) *Client {
 	client := resty.New()
 
 	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.MaxIdleConns = cfg.GetHttpClient().MaxIdleConns
-	transport.MaxConnsPerHost = cfg.GetHttpClient().MaxConnsPerHost
-	transport.MaxIdleConnsPerHost = cfg.GetHttpClient().MaxIdleConnsPerHost
-	transport.ResponseHeaderTimeout = cfg.GetHttpClient().ResponseHeaderTimeout
-	transport.TLSHandshakeTimeout = cfg.GetHttpClient().TLSHandshakeTimeout
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	transport.ExpectContinueTimeout = cfg.GetHttpClient().ExpectContinueTimeout
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transport.ExpectContinueTimeout = cfg.ExpectContinueTimeout
 	transport.DialContext = (&net.Dialer{
-		Timeout:   cfg.GetHttpClient().DialTimeout,
-		KeepAlive: cfg.GetHttpClient().DialKeepAlive,
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.DialKeepAlive,
 	}).DialContext
 
 	client.
@@ -52,17 +66,17 @@ func New(cfg *config.Config, baseUrl string, l *logger.Logger) *Client {
 				return 0, nil
 			}).
 		SetLogger(l).
-		SetRetryCount(cfg.GetHttpClient().RetryCount).
-		SetRetryWaitTime(cfg.GetHttpClient().RetryWaitCount).
+		SetRetryCount(cfg.RetryCount).
+		SetRetryWaitTime(cfg.RetryWaitCount).
 		AddRetryCondition(func(response *resty.Response, err error) bool {
 			return response.StatusCode() == http.StatusRequestTimeout ||
 				response.StatusCode() >= http.StatusInternalServerError ||
 				response.StatusCode() == http.StatusGatewayTimeout ||
 				err != nil
 		}).
-		SetRetryMaxWaitTime(cfg.GetHttpClient().RetryMaxWaitTime)
+		SetRetryMaxWaitTime(cfg.RetryMaxWaitTime)
 
-	return &Client{client}
+	return &Client{Client: client, log: l}
 }
 
 func (c *Client) Get(ctx context.Context, request Request, result any) (*Response, error) {
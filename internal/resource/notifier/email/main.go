@@ -0,0 +1,61 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type Email struct {
+	log   *logger.Logger
+	email device.Email
+}
+
+func NewSink(l *logger.Logger, email device.Email) notifier.NotificationSink {
+	return &Email{
+		log:   l,
+		email: email,
+	}
+}
+
+// Send mails the notification. STARTTLS is used whenever the server offers it.
+func (e *Email) Send(ctx context.Context, notification device.Notification) error {
+	var auth smtp.Auth
+	if e.email.Username != "" {
+		auth = smtp.PlainAuth("", e.email.Username, e.email.Password, e.email.Host)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + e.email.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(e.email.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", notifier.Title(notification)) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(notifier.Text(notification) + "\r\n")
+
+	// smtp.SendMail has no context support, run it aside so ctx is honored
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(e.email.Host, e.email.Port), auth, e.email.From, e.email.To, []byte(msg.String()))
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("email error: %w", err)
+		}
+	}
+	e.log.Infof("Email sent to %s", strings.Join(e.email.To, ", "))
+	return nil
+}
@@ -1,38 +1,35 @@
 package graylog
 
 import (
+	"context"
 	"fmt"
-	"github.com/alexwbaule/ups-metrics/internal/application"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
 	"gopkg.in/Graylog2/go-gelf.v1/gelf"
 	"time"
 )
 
 type Gelf struct {
-	Address  string
-	gelf     *gelf.Writer
-	Hostname string
-	log      *logger.Logger
+	Address string
+	gelf    *gelf.Writer
+	log     *logger.Logger
 }
 
-func NewGelf(l *application.Application) *Gelf {
-	cf := l.Config.GetGelfConfig()
-
+func NewSink(l *logger.Logger, cf device.Gelf) notifier.NotificationSink {
 	g, err := gelf.NewWriter(fmt.Sprintf("%s:%s", cf.Address, cf.Port))
 	if err != nil {
-		l.Log.Infof("Error creating Gelf Writer: %s", err.Error())
+		l.Infof("Error creating Gelf Writer: %s", err.Error())
 	}
 	return &Gelf{
-		Address:  fmt.Sprintf("%s:%s", cf.Address, cf.Port),
-		gelf:     g,
-		Hostname: l.Config.GetDeviceAddress(),
-		log:      l.Log,
+		Address: fmt.Sprintf("%s:%s", cf.Address, cf.Port),
+		gelf:    g,
+		log:     l,
 	}
-
 }
 
-func (m *Gelf) LogNotifications(not device.Notification) {
+// Send logs the notification using the device name as GELF host.
+func (m *Gelf) Send(ctx context.Context, not device.Notification) error {
 	var dt time.Time
 	var full string
 	extraMessage := map[string]interface{}{
@@ -40,6 +37,8 @@ func (m *Gelf) LogNotifications(not device.Notification) {
 		"id":               not.ID,
 		"message":          not.Message,
 		"date":             not.Date,
+		"event_type":       string(not.Type),
+		"severity":         not.Severity.String(),
 	}
 
 	parse, err := time.ParseInLocation("02/01/2006 15:04:05", not.Date, time.Local)
@@ -50,22 +49,31 @@ func (m *Gelf) LogNotifications(not device.Notification) {
 		dt = parse
 	}
 
-	full = fmt.Sprintf("Notification %d on %s with %s", not.ID, not.Date, not.Message)
+	full = notifier.Text(not)
+
+	level := int32(device.SeverityInformational)
+	if not.Type != "" {
+		level = int32(not.Severity)
+	}
 
 	msg := &gelf.Message{
 		Version:  "1.1",
-		Host:     m.Hostname,
+		Host:     not.Device,
 		Short:    full,
 		TimeUnix: float64(dt.Unix()),
-		Level:    6,
+		Level:    level,
 		Facility: "ups-metrics",
 		Extra:    extraMessage,
 	}
+	if m.gelf == nil {
+		return fmt.Errorf("gelf writer for %s is not available", m.Address)
+	}
 	err = m.gelf.WriteMessage(msg)
 	if err != nil {
-		m.log.Infof("Error writing message: %s", err.Error())
+		return fmt.Errorf("error writing message: %w", err)
 	}
 	m.log.Infof("Sended: %s", full)
+	return nil
 }
 
 func (m *Gelf) Disconnect() {
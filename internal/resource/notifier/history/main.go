@@ -0,0 +1,46 @@
+package history
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"sync"
+)
+
+const defaultSize = 100
+
+// History keeps the last notifications of every device in memory, for the
+// servers that report recent events.
+type History struct {
+	size int
+	mu   sync.RWMutex
+	last map[string][]device.Notification
+}
+
+func NewHistory() *History {
+	return &History{
+		size: defaultSize,
+		last: make(map[string][]device.Notification),
+	}
+}
+
+func (h *History) Send(ctx context.Context, notification device.Notification) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := append(h.last[notification.Device], notification)
+	if len(list) > h.size {
+		list = list[len(list)-h.size:]
+	}
+	h.last[notification.Device] = list
+	return nil
+}
+
+// List returns the notifications of the device, oldest first.
+func (h *History) List(name string) []device.Notification {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := make([]device.Notification, len(h.last[name]))
+	copy(list, h.last[name])
+	return list
+}
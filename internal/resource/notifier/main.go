@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"sync"
+)
+
+type NotificationSink interface {
+	Send(ctx context.Context, notification device.Notification) error
+}
+
+// Title and Text are the plain text rendering shared by the chat and mail sinks.
+func Title(notification device.Notification) string {
+	return fmt.Sprintf("UPS %s", notification.Device)
+}
+
+func Text(notification device.Notification) string {
+	return fmt.Sprintf("Notification %d on %s with %s", notification.ID, notification.Date, notification.Message)
+}
+
+// Multi delivers each notification to every registered sink. When some sinks
+// fail, the ones that succeeded are remembered, so a retry of the same
+// notification only goes to the sinks that still miss it.
+type Multi struct {
+	log       *logger.Logger
+	sinks     []namedSink
+	mu        sync.Mutex
+	delivered map[string]map[string]bool
+}
+
+type namedSink struct {
+	name string
+	sink NotificationSink
+}
+
+func NewMulti(l *logger.Logger) *Multi {
+	return &Multi{
+		log:       l,
+		delivered: make(map[string]map[string]bool),
+	}
+}
+
+// Add registers a sink. It must be called before Send.
+func (m *Multi) Add(name string, sink NotificationSink) {
+	m.sinks = append(m.sinks, namedSink{name: name, sink: sink})
+}
+
+func (m *Multi) Len() int {
+	return len(m.sinks)
+}
+
+func (m *Multi) Names() []string {
+	names := make([]string, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (m *Multi) Send(ctx context.Context, notification device.Notification) error {
+	var errs []error
+	key := fmt.Sprintf("%s/%d/%s/%s", notification.Device, notification.ID, notification.Date, notification.Message)
+
+	m.mu.Lock()
+	delivered := m.delivered[key]
+	m.mu.Unlock()
+
+	if delivered == nil {
+		delivered = make(map[string]bool, len(m.sinks))
+	}
+
+	for _, s := range m.sinks {
+		if delivered[s.name] {
+			continue
+		}
+		err := s.sink.Send(ctx, notification)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		delivered[s.name] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(errs) > 0 {
+		m.delivered[key] = delivered
+		return errors.Join(errs...)
+	}
+	delete(m.delivered, key)
+	return nil
+}
@@ -0,0 +1,76 @@
+package ntfy
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+)
+
+const defaultServer = "https://ntfy.sh"
+
+type Ntfy struct {
+	log    *logger.Logger
+	client *client.Client
+	ntfy   device.Ntfy
+}
+
+func NewSink(l *logger.Logger, cfg device.HttpClient, ntfy device.Ntfy) notifier.NotificationSink {
+	server := ntfy.Server
+	if server == "" {
+		server = defaultServer
+	}
+	return &Ntfy{
+		log:    l,
+		client: client.New(cfg, server, l),
+		ntfy:   ntfy,
+	}
+}
+
+// Send publishes the notification to the configured topic.
+func (n *Ntfy) Send(ctx context.Context, notification device.Notification) error {
+	headers := map[string]string{
+		"Title":    notifier.Title(notification),
+		"Priority": priority(notification),
+	}
+	if notification.Type != "" {
+		headers["Tags"] = string(notification.Type)
+	}
+	if n.ntfy.Token != "" {
+		headers["Authorization"] = "Bearer " + n.ntfy.Token
+	}
+	request := client.Request{
+		Url: "/{topic}",
+		PathParameters: map[string]string{
+			"topic": n.ntfy.Topic,
+		},
+		Headers: headers,
+	}
+	post, err := n.client.Post(ctx, request, notifier.Text(notification), nil)
+	if err != nil {
+		return err
+	}
+	if post.IsError() {
+		return fmt.Errorf("ntfy error: %d %s", post.StatusCode(), post.String())
+	}
+	n.log.Infof("Ntfy response: %d", post.StatusCode())
+	return nil
+}
+
+// priority maps the event severity to the ntfy priority (1 to 5).
+func priority(notification device.Notification) string {
+	if notification.Type == "" {
+		return "3"
+	}
+	switch {
+	case notification.Severity <= device.SeverityCritical:
+		return "5"
+	case notification.Severity <= device.SeverityWarning:
+		return "4"
+	case notification.Severity == device.SeverityNotice:
+		return "3"
+	}
+	return "2"
+}
@@ -0,0 +1,47 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+)
+
+type Slack struct {
+	log    *logger.Logger
+	client *client.Client
+	slack  device.Slack
+}
+
+type message struct {
+	Text string `json:"text"`
+}
+
+func NewSink(l *logger.Logger, cfg device.HttpClient, slack device.Slack) notifier.NotificationSink {
+	return &Slack{
+		log:    l,
+		client: client.New(cfg, "", l),
+		slack:  slack,
+	}
+}
+
+// Send posts the notification to a Slack compatible incoming webhook.
+func (s *Slack) Send(ctx context.Context, notification device.Notification) error {
+	request := client.Request{
+		Url: s.slack.Url,
+	}
+	body := message{
+		Text: fmt.Sprintf("*%s*\n%s", notifier.Title(notification), notifier.Text(notification)),
+	}
+	post, err := s.client.Post(ctx, request, body, nil)
+	if err != nil {
+		return err
+	}
+	if post.IsError() {
+		return fmt.Errorf("slack error: %d %s", post.StatusCode(), post.String())
+	}
+	s.log.Infof("Slack response: %d", post.StatusCode())
+	return nil
+}
@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+)
+
+const apiUrl = "https://api.telegram.org"
+
+type Telegram struct {
+	log      *logger.Logger
+	client   *client.Client
+	telegram device.Telegram
+}
+
+type message struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+type response struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func NewSink(l *logger.Logger, cfg device.HttpClient, telegram device.Telegram) notifier.NotificationSink {
+	return &Telegram{
+		log:      l,
+		client:   client.New(cfg, apiUrl, l),
+		telegram: telegram,
+	}
+}
+
+// Send sends the notification as a message of the bot to the configured chat.
+func (t *Telegram) Send(ctx context.Context, notification device.Notification) error {
+	var result response
+
+	request := client.Request{
+		Url: "/bot{token}/sendMessage",
+		PathParameters: map[string]string{
+			"token": t.telegram.Token,
+		},
+	}
+	body := message{
+		ChatID: t.telegram.ChatID,
+		Text:   fmt.Sprintf("%s\n%s", notifier.Title(notification), notifier.Text(notification)),
+	}
+	post, err := t.client.Post(ctx, request, body, &result)
+	if err != nil {
+		return err
+	}
+	if post.IsError() || !result.Ok {
+		return fmt.Errorf("telegram error: %d %s", post.StatusCode(), result.Description)
+	}
+	t.log.Infof("Telegram response: %d", post.StatusCode())
+	return nil
+}
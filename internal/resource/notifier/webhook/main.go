@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier"
+)
+
+type Webhook struct {
+	log     *logger.Logger
+	client  *client.Client
+	webhook device.Webhook
+}
+
+type payload struct {
+	Device   string `json:"device"`
+	ID       int    `json:"id"`
+	Message  string `json:"message"`
+	Date     string `json:"date"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Text     string `json:"text"`
+}
+
+func NewSink(l *logger.Logger, cfg device.HttpClient, webhook device.Webhook) notifier.NotificationSink {
+	return &Webhook{
+		log:     l,
+		client:  client.New(cfg, "", l),
+		webhook: webhook,
+	}
+}
+
+// Send posts the notification as JSON to the configured url.
+func (w *Webhook) Send(ctx context.Context, notification device.Notification) error {
+	request := client.Request{
+		Url:     w.webhook.Url,
+		Headers: w.webhook.Headers,
+	}
+	body := payload{
+		Device:   notification.Device,
+		ID:       notification.ID,
+		Message:  notification.Message,
+		Date:     notification.Date,
+		Type:     string(notification.Type),
+		Severity: notification.Severity.String(),
+		Text:     notifier.Text(notification),
+	}
+	post, err := w.client.Post(ctx, request, body, nil)
+	if err != nil {
+		return err
+	}
+	if post.IsError() {
+		return fmt.Errorf("webhook error: %d %s", post.StatusCode(), post.String())
+	}
+	w.log.Infof("Webhook response: %d", post.StatusCode())
+	return nil
+}
@@ -0,0 +1,163 @@
+package apcupsd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	maxCommand  = 512
+	readTimeout = 5 * time.Minute
+)
+
+// Server answers the apcupsd Network Information Server protocol with the
+// readings of a single device, for legacy clients like apcaccess, apcupsd-cgi
+// and monitoring plugins. Requests and answer lines are sent as records
+// prefixed by their length as a 2 bytes big endian integer, and every answer
+// ends with an empty record.
+type Server struct {
+	log       *logger.Logger
+	cfg       device.Apcupsd
+	store     *latest.Store
+	history   *history.History
+	estimator device.RuntimeEstimator
+	started   time.Time
+}
+
+func NewServer(l *application.Application, store *latest.Store, history *history.History, estimator device.RuntimeEstimator) *Server {
+	cfg := l.Config.GetServersConfig().Apcupsd
+	return &Server{
+		log:       l.Log.With("server", "apcupsd", "device", cfg.Device),
+		cfg:       cfg,
+		store:     store,
+		history:   history,
+		estimator: estimator,
+		started:   time.Now(),
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("apcupsd server: %w", err)
+	}
+	s.log.Infof("apcupsd NIS server listening on %s", s.cfg.Listen)
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				s.log.Infof("stopping apcupsd server...")
+				return context.Canceled
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("apcupsd server: %w", err)
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		command, err := readRecord(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.log.Debugf("apcupsd client %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		var lines []string
+		switch strings.TrimSpace(command) {
+		case "status":
+			lines = s.status()
+		case "events":
+			lines = s.events()
+		default:
+			lines = []string{"Invalid command\n"}
+		}
+		err = writeRecords(conn, lines)
+		if err != nil {
+			s.log.Debugf("apcupsd client %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// events returns the notifications kept for the device, oldest first, in the
+// format of the apcupsd events file.
+func (s *Server) events() []string {
+	var lines []string
+
+	for _, n := range s.history.List(s.cfg.Device) {
+		date, err := time.ParseInLocation("02/01/2006 15:04:05", n.Date, time.Local)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s  %s\n", n.Date, n.Message))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", date.Format("2006-01-02 15:04:05 -0700"), n.Message))
+	}
+	return lines
+}
+
+func readRecord(r io.Reader) (string, error) {
+	var size uint16
+
+	err := binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return "", err
+	}
+	if size == 0 || size > maxCommand {
+		return "", fmt.Errorf("invalid command length %d", size)
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func writeRecords(w io.Writer, lines []string) error {
+	var buf []byte
+
+	for _, line := range lines {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(line)))
+		buf = append(buf, line...)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return name
+}
@@ -0,0 +1,187 @@
+package apcupsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/notifier/history"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, onGrid bool, level float64) *Server {
+	t.Helper()
+	store := latest.NewStore()
+	err := store.Write(context.Background(), device.Reading{
+		Device:   "rack",
+		GetAt:    time.Now(),
+		UPSType:  "SMS Net 4+",
+		DeployID: "1234",
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: level},
+			device.QuantityInputVoltage: {Value: 127},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: onGrid,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		log:     logger.NewLogger(),
+		cfg:     device.Apcupsd{Device: "rack", LowBattery: 20, MaxAge: time.Minute},
+		store:   store,
+		history: history.NewHistory(),
+		started: time.Now(),
+	}
+}
+
+// request sends the command over a pipe and returns the records of the
+// answer, up to the empty record that ends it.
+func request(t *testing.T, s *Server, command string) []string {
+	t.Helper()
+	conn, server := net.Pipe()
+	go s.serve(server)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(command))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Write([]byte(command))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []string
+	for {
+		var size uint16
+		err = binary.Read(conn, binary.BigEndian, &size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size == 0 {
+			return records
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(buf))
+	}
+}
+
+// fields returns the value of every status field by name.
+func fields(records []string) map[string]string {
+	values := map[string]string{}
+	for _, r := range records {
+		name, value, _ := strings.Cut(strings.TrimSuffix(r, "\n"), ": ")
+		values[strings.TrimSpace(name)] = value
+	}
+	return values
+}
+
+func TestReadRecord(t *testing.T) {
+	record := func(size uint16, data string) *bytes.Reader {
+		return bytes.NewReader(append(binary.BigEndian.AppendUint16(nil, size), data...))
+	}
+	command, err := readRecord(record(6, "status"))
+	if err != nil || command != "status" {
+		t.Errorf("read %q (%v), want status", command, err)
+	}
+	for _, r := range []*bytes.Reader{record(0, ""), record(maxCommand+1, ""), record(6, "stat")} {
+		_, err = readRecord(r)
+		if err == nil {
+			t.Errorf("no error for %d bytes", r.Len())
+		}
+	}
+
+	var buf bytes.Buffer
+	err = writeRecords(&buf, []string{"a\n", "bc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("\x00\x02a\n\x00\x03bc\n\x00\x00"); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote %q, want %q", buf.Bytes(), want)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	records := request(t, newTestServer(t, true, 95), "status")
+
+	// the header counts the records and bytes of the whole block
+	size := 0
+	for _, r := range records {
+		size += len(r)
+	}
+	if want := fmt.Sprintf("APC      : 001,%03d,%04d\n", len(records), size); records[0] != want {
+		t.Errorf("header %q, want %q", records[0], want)
+	}
+	if !strings.HasPrefix(records[len(records)-1], "END APC  : ") {
+		t.Errorf("last record %q, want END APC", records[len(records)-1])
+	}
+	values := fields(records)
+	want := map[string]string{
+		"UPSNAME":  "rack",
+		"MODEL":    "SMS Net 4+",
+		"STATUS":   "ONLINE",
+		"LINEV":    "127.0 Volts",
+		"BCHARGE":  "95.0 Percent",
+		"MBATTCHG": "20 Percent",
+		"SERIALNO": "1234",
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("%s is %q, want %q", name, values[name], value)
+		}
+	}
+	if _, ok := values["LOADPCT"]; ok {
+		t.Error("LOADPCT reported without a load")
+	}
+
+	records = request(t, newTestServer(t, false, 15), "status")
+	if got := fields(records)["STATUS"]; got != "ONBATT LOWBATT" {
+		t.Errorf("on battery STATUS %q, want ONBATT LOWBATT", got)
+	}
+
+	s := newTestServer(t, true, 95)
+	s.cfg.Device = "spare"
+	records = request(t, s, "status")
+	if got := fields(records)["STATUS"]; got != "COMMLOST" {
+		t.Errorf("without a reading STATUS %q, want COMMLOST", got)
+	}
+
+	if got := request(t, s, "help"); !slices.Equal(got, []string{"Invalid command\n"}) {
+		t.Errorf("unknown command answered %q", got)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := newTestServer(t, true, 95)
+	for _, n := range []device.Notification{
+		{Device: "rack", Date: "01/03/2024 10:00:00", Message: "Falha na rede"},
+		{Device: "other", Date: "01/03/2024 10:00:05", Message: "Falha na rede"},
+		{Device: "rack", Date: "yesterday", Message: "Rede restabelecida"},
+	} {
+		err := s.history.Send(context.Background(), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	date := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.Local).Format(dateLayout)
+	want := []string{date + "  Falha na rede\n", "yesterday  Rede restabelecida\n"}
+	if got := request(t, s, "events"); !slices.Equal(got, want) {
+		t.Errorf("events %q, want %q", got, want)
+	}
+}
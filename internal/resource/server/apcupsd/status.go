@@ -0,0 +1,121 @@
+package apcupsd
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02 15:04:05 -0700"
+	headerSize = len("APC      : 001,000,0000\n")
+)
+
+type field struct {
+	name  string
+	value string
+}
+
+// gauges maps the exported metric names to the apcupsd status fields and
+// their units.
+var gauges = []struct {
+	metric string
+	name   string
+	unit   string
+}{
+	{metric: "input_voltage", name: "LINEV", unit: "Volts"},
+	{metric: "ups_load", name: "LOADPCT", unit: "Percent"},
+	{metric: "battery_level", name: "BCHARGE", unit: "Percent"},
+	{metric: "output_voltage", name: "OUTPUTV", unit: "Volts"},
+	{metric: "ups_temperature", name: "ITEMP", unit: "C"},
+	{metric: "output_frequency", name: "LINEFREQ", unit: "Hz"},
+}
+
+// status builds the apcupsd status block. When the last reading is missing or
+// older than max_age the UPS is reported as COMMLOST.
+func (s *Server) status() []string {
+	now := time.Now()
+	fields := []field{
+		{name: "DATE", value: now.Format(dateLayout)},
+		{name: "HOSTNAME", value: hostname()},
+		{name: "VERSION", value: "3.14.14 (ups-metrics " + logger.Version + ")"},
+		{name: "UPSNAME", value: s.cfg.Device},
+		{name: "CABLE", value: "Ethernet Link"},
+		{name: "DRIVER", value: "ups-metrics"},
+		{name: "UPSMODE", value: "Net"},
+		{name: "STARTTIME", value: s.started.Format(dateLayout)},
+	}
+
+	reading, ok := s.store.Get(s.cfg.Device)
+	if !ok || now.Sub(reading.GetAt) > s.cfg.MaxAge {
+		fields = append(fields, field{name: "STATUS", value: "COMMLOST"})
+	} else {
+		values := reading.Values()
+
+		fields = append(fields,
+			field{name: "MODEL", value: reading.UPSType},
+			field{name: "STATUS", value: s.flags(values)},
+		)
+		for _, gauge := range gauges {
+			if v, ok := values[gauge.metric]; ok {
+				fields = append(fields, field{name: gauge.name, value: fmt.Sprintf("%.1f %s", v, gauge.unit)})
+			}
+		}
+		if s.estimator != nil {
+			if runtime, ok := s.estimator.Runtime(s.cfg.Device); ok {
+				fields = append(fields, field{name: "TIMELEFT", value: fmt.Sprintf("%.1f Minutes", runtime.Minutes())})
+			}
+		}
+		fields = append(fields,
+			field{name: "MBATTCHG", value: fmt.Sprintf("%.0f Percent", s.cfg.LowBattery)},
+			field{name: "SERIALNO", value: reading.DeployID},
+		)
+	}
+
+	lines := make([]string, 0, len(fields)+2)
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-9s: %s\n", f.name, f.value))
+	}
+	lines = append(lines, fmt.Sprintf("%-9s: %s\n", "END APC", now.Format(dateLayout)))
+
+	// the header counts the records and bytes of the whole block, itself included
+	size := 0
+	for _, line := range lines {
+		size += len(line)
+	}
+	header := fmt.Sprintf("%-9s: 001,%03d,%04d\n", "APC", len(lines)+1, size+headerSize)
+
+	return append([]string{header}, lines...)
+}
+
+// flags builds STATUS from the UPS states: ONLINE or ONBATT, LOWBATT when on
+// battery under the low battery level, and REPLACEBATT, OVERLOAD and BOOST.
+func (s *Server) flags(values map[string]float64) string {
+	var flags []string
+
+	// the grid state is left out when not reported, like ups.status of the
+	// NUT server
+	switch grid, reported := values["on_grid"]; {
+	case reported && grid == 1:
+		flags = append(flags, "ONLINE")
+	case reported:
+		flags = append(flags, "ONBATT")
+		if level, ok := values["battery_level"]; ok && level <= s.cfg.LowBattery {
+			flags = append(flags, "LOWBATT")
+		}
+	}
+	if values["battery_fail"] == 1 {
+		flags = append(flags, "REPLACEBATT")
+	}
+	if values["on_high_power"] == 1 {
+		flags = append(flags, "OVERLOAD")
+	}
+	if values["on_boost"] == 1 {
+		flags = append(flags, "BOOST")
+	}
+	return strings.Join(flags, " ")
+}
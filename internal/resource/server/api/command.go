@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Executor runs a command on a UPS.
+type Executor interface {
+	Devices() []string
+	Supported() []smsups.Command
+	Execute(ctx context.Context, name string, cmd smsups.Command, delay time.Duration) error
+}
+
+type commandRequest struct {
+	Device  string `json:"device"`
+	Command string `json:"command"`
+	Delay   string `json:"delay,omitempty"`
+}
+
+type commandResponse struct {
+	Device  string `json:"device"`
+	Command string `json:"command"`
+	Delay   string `json:"delay,omitempty"`
+	Status  string `json:"status"`
+}
+
+type commandList struct {
+	Devices  []string         `json:"devices"`
+	Commands []smsups.Command `json:"commands"`
+}
+
+// CommandHandler lists the supported commands on GET and runs one on POST,
+// with a body like {"device": "rack", "command": "shutdown.return", "delay":
+// "5m"}. Experimental commands are refused unless enabled.
+func CommandHandler(executor Executor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			WriteJSON(w, http.StatusOK, commandList{
+				Devices:  executor.Devices(),
+				Commands: executor.Supported(),
+			})
+		case http.MethodPost:
+			var request commandRequest
+
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+				return
+			}
+			if !slices.Contains(executor.Devices(), request.Device) {
+				WriteError(w, http.StatusNotFound, fmt.Errorf("unknown device %s", request.Device))
+				return
+			}
+			cmd, err := smsups.ParseCommand(request.Command)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			if !slices.Contains(executor.Supported(), cmd) {
+				WriteError(w, http.StatusForbidden, fmt.Errorf("command %s is experimental, set commands.experimental to send it", cmd))
+				return
+			}
+			var delay time.Duration
+			if request.Delay != "" {
+				delay, err = time.ParseDuration(request.Delay)
+				if err != nil {
+					WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid delay: %w", err))
+					return
+				}
+			}
+			if delay < 0 || (delay > 0 && !cmd.Scheduled()) {
+				WriteError(w, http.StatusBadRequest, fmt.Errorf("command %s does not accept a delay", cmd))
+				return
+			}
+			err = executor.Execute(r.Context(), request.Device, cmd, delay)
+			if err != nil {
+				WriteError(w, http.StatusBadGateway, err)
+				return
+			}
+			WriteJSON(w, http.StatusOK, commandResponse{
+				Device:  request.Device,
+				Command: request.Command,
+				Delay:   request.Delay,
+				Status:  "accepted",
+			})
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"net/http"
+)
+
+// EnergyReporter tells the energy delivered by every UPS.
+type EnergyReporter interface {
+	Usage() []device.EnergyUsage
+}
+
+// EnergyHandler lists the energy delivered by each UPS on GET, in total and
+// per day and month. ?device=<name> returns a single device.
+func EnergyHandler(reporter EnergyReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		usage := reporter.Usage()
+
+		name := r.URL.Query().Get("device")
+		if name == "" {
+			WriteJSON(w, http.StatusOK, usage)
+			return
+		}
+		for _, u := range usage {
+			if u.Device == name {
+				WriteJSON(w, http.StatusOK, u)
+				return
+			}
+		}
+		WriteError(w, http.StatusNotFound, fmt.Errorf("no energy accounted for device %s", name))
+	})
+}
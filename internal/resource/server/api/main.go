@@ -0,0 +1,63 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"net/http"
+	"strings"
+)
+
+// Handler serves the HTTP API next to the Prometheus metrics. Every request
+// must carry the configured token as "Authorization: Bearer <token>".
+type Handler struct {
+	log   *logger.Logger
+	token string
+	mux   *http.ServeMux
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewHandler(l *application.Application) (*Handler, error) {
+	cfg := l.Config.GetServersConfig().Api
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("api server: a token is required")
+	}
+	return &Handler{
+		log:   l.Log.With("server", "api"),
+		token: cfg.Token,
+		mux:   http.NewServeMux(),
+	}, nil
+}
+
+// Handle registers an endpoint under /api/.
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		h.log.Warnf("unauthorized %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		WriteError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// WriteJSON writes v as the JSON response body.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes err as a JSON error response.
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"net/http"
+	"strconv"
+)
+
+const defaultOutageDays = 30
+
+// OutageReporter tells the outages of every UPS.
+type OutageReporter interface {
+	Outages(device string, days int) device.OutageReport
+}
+
+// OutageHandler lists the outages of the last 30 days on GET, newest first,
+// with their count and duration per day. ?device=<name> returns a single
+// device and ?days=<n> another number of days.
+func OutageHandler(reporter OutageReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		days := defaultOutageDays
+		if value := r.URL.Query().Get("days"); value != "" {
+			var err error
+			days, err = strconv.Atoi(value)
+			if err != nil || days < 1 {
+				WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid days %q", value))
+				return
+			}
+		}
+		WriteJSON(w, http.StatusOK, reporter.Outages(r.URL.Query().Get("device"), days))
+	})
+}
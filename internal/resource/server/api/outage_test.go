@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// reporter returns a single day of outages, keeping what it was asked.
+type reporter struct {
+	device string
+	days   int
+}
+
+func (r *reporter) Outages(name string, days int) device.OutageReport {
+	r.device, r.days = name, days
+	return device.OutageReport{
+		Outages: []device.Outage{{Device: "rack", Seconds: 90}},
+		Days:    []device.OutageDay{{Date: "2024-03-01", Count: 1, Seconds: 90}},
+	}
+}
+
+func TestOutageHandler(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		status int
+		device string
+		days   int
+	}{
+		{method: http.MethodGet, target: "/api/v1/outages", status: http.StatusOK, days: 30},
+		{method: http.MethodGet, target: "/api/v1/outages?device=rack&days=7", status: http.StatusOK, device: "rack", days: 7},
+		{method: http.MethodGet, target: "/api/v1/outages?days=0", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/api/v1/outages?days=week", status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/api/v1/outages", status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		r := &reporter{}
+		w := httptest.NewRecorder()
+		OutageHandler(r).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET" {
+			t.Errorf("%s %s: allows %q, want GET", tt.method, tt.target, w.Header().Get("Allow"))
+		}
+		if tt.status != http.StatusOK {
+			if r.days != 0 {
+				t.Errorf("%s %s: asked the reporter after an error", tt.method, tt.target)
+			}
+			continue
+		}
+		if r.device != tt.device || r.days != tt.days {
+			t.Errorf("%s %s: asked for %q over %d days, want %q over %d", tt.method, tt.target, r.device, r.days, tt.device, tt.days)
+		}
+		var report device.OutageReport
+		err := json.NewDecoder(w.Body).Decode(&report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Outages) != 1 || len(report.Days) != 1 || report.Days[0].Seconds != 90 {
+			t.Errorf("%s %s: report %+v", tt.method, tt.target, report)
+		}
+	}
+}
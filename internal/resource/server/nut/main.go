@@ -0,0 +1,467 @@
+package nut
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	netVersion  = "1.3"
+	readTimeout = 5 * time.Minute
+)
+
+// Commander runs the instant commands of a UPS, like test.battery.start.
+type Commander interface {
+	Commands(ups string) []string
+	Run(ctx context.Context, ups, command string) error
+}
+
+// Server answers the Network UPS Tools protocol with the last readings of
+// every device, so NUT clients (upsmon, Home Assistant, Synology...) can
+// monitor them. UPS names are the device names.
+type Server struct {
+	log       *logger.Logger
+	cfg       device.Nut
+	store     *latest.Store
+	devices   []device.Device
+	commander Commander
+	estimator device.RuntimeEstimator
+	mu        sync.Mutex
+	logins    map[string]int
+}
+
+type session struct {
+	conn     net.Conn
+	username string
+	password string
+	login    string
+}
+
+func NewServer(l *application.Application, store *latest.Store, commander Commander, estimator device.RuntimeEstimator) *Server {
+	return &Server{
+		log:       l.Log.With("server", "nut"),
+		cfg:       l.Config.GetServersConfig().Nut,
+		store:     store,
+		devices:   l.Config.GetDevices(),
+		commander: commander,
+		estimator: estimator,
+		logins:    make(map[string]int),
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("nut server: %w", err)
+	}
+	s.log.Infof("NUT server listening on %s", s.cfg.Listen)
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				s.log.Infof("stopping nut server...")
+				return context.Canceled
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("nut server: %w", err)
+		}
+		go s.serve(ctx, conn)
+	}
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	sess := &session{conn: conn}
+	defer func() {
+		if sess.login != "" {
+			s.mu.Lock()
+			s.logins[sess.login]--
+			s.mu.Unlock()
+		}
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if !scanner.Scan() {
+			return
+		}
+		args, err := split(scanner.Text())
+		if err != nil {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !s.handle(ctx, sess, args) {
+			return
+		}
+	}
+}
+
+// handle answers a single command, returning false when the connection must
+// be closed.
+func (s *Server) handle(ctx context.Context, sess *session, args []string) bool {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch cmd {
+	case "VER":
+		s.reply(sess, "Network UPS Tools upsd 2.8.0 - ups-metrics "+logger.Version)
+	case "NETVER":
+		s.reply(sess, netVersion)
+	case "HELP":
+		s.reply(sess, "Commands: HELP VER GET LIST SET INSTCMD LOGIN LOGOUT USERNAME PASSWORD STARTTLS")
+	case "STARTTLS":
+		s.reply(sess, "ERR FEATURE-NOT-CONFIGURED")
+	case "USERNAME":
+		if len(args) != 1 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+		} else if sess.username != "" {
+			s.reply(sess, "ERR ALREADY-SET-USERNAME")
+		} else {
+			sess.username = args[0]
+			s.reply(sess, "OK")
+		}
+	case "PASSWORD":
+		if len(args) != 1 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+		} else if sess.password != "" {
+			s.reply(sess, "ERR ALREADY-SET-PASSWORD")
+		} else {
+			sess.password = args[0]
+			s.reply(sess, "OK")
+		}
+	case "LOGIN":
+		s.handleLogin(sess, args)
+	case "PRIMARY", "MASTER":
+		if len(args) != 1 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+		} else if !s.known(args[0]) {
+			s.reply(sess, "ERR UNKNOWN-UPS")
+		} else if !s.authorized(sess) {
+			s.reply(sess, "ERR ACCESS-DENIED")
+		} else if cmd == "MASTER" {
+			s.reply(sess, "OK MASTER-GRANTED")
+		} else {
+			s.reply(sess, "OK PRIMARY-GRANTED")
+		}
+	case "FSD":
+		s.reply(sess, "ERR CMD-NOT-SUPPORTED")
+	case "LOGOUT":
+		s.reply(sess, "OK Goodbye")
+		return false
+	case "GET":
+		s.handleGet(sess, args)
+	case "LIST":
+		s.handleList(sess, args)
+	case "SET":
+		s.reply(sess, "ERR READONLY")
+	case "INSTCMD":
+		s.handleInstCmd(ctx, sess, args)
+	default:
+		s.reply(sess, "ERR UNKNOWN-COMMAND")
+	}
+	return true
+}
+
+func (s *Server) handleLogin(sess *session, args []string) {
+	switch {
+	case len(args) != 1:
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+	case sess.login != "":
+		s.reply(sess, "ERR ALREADY-LOGGED-IN")
+	case s.cfg.Username != "" && sess.username == "":
+		s.reply(sess, "ERR USERNAME-REQUIRED")
+	case s.cfg.Username != "" && sess.password == "":
+		s.reply(sess, "ERR PASSWORD-REQUIRED")
+	case s.cfg.Username != "" && !s.authorized(sess):
+		s.reply(sess, "ERR ACCESS-DENIED")
+	case !s.known(args[0]):
+		s.reply(sess, "ERR UNKNOWN-UPS")
+	default:
+		sess.login = args[0]
+		s.mu.Lock()
+		s.logins[sess.login]++
+		s.mu.Unlock()
+		s.reply(sess, "OK")
+	}
+}
+
+func (s *Server) handleGet(sess *session, args []string) {
+	if len(args) < 2 {
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+		return
+	}
+	what, ups := strings.ToUpper(args[0]), args[1]
+	if !s.known(ups) {
+		s.reply(sess, "ERR UNKNOWN-UPS")
+		return
+	}
+
+	switch what {
+	case "NUMLOGINS":
+		s.mu.Lock()
+		n := s.logins[ups]
+		s.mu.Unlock()
+		s.reply(sess, fmt.Sprintf("NUMLOGINS %s %d", ups, n))
+	case "UPSDESC":
+		s.reply(sess, fmt.Sprintf("UPSDESC %s %s", ups, quote(s.description(ups))))
+	case "VAR", "TYPE", "DESC":
+		if len(args) != 3 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+			return
+		}
+		vars, err := s.variables(ups)
+		if err != "" {
+			s.reply(sess, err)
+			return
+		}
+		for _, v := range vars {
+			if v.name != args[2] {
+				continue
+			}
+			switch what {
+			case "VAR":
+				s.reply(sess, fmt.Sprintf("VAR %s %s %s", ups, v.name, quote(v.value)))
+			case "TYPE":
+				s.reply(sess, fmt.Sprintf("TYPE %s %s %s", ups, v.name, varType(v)))
+			case "DESC":
+				s.reply(sess, fmt.Sprintf("DESC %s %s %s", ups, v.name, quote(varDescription(v.name))))
+			}
+			return
+		}
+		s.reply(sess, "ERR VAR-NOT-SUPPORTED")
+	case "CMDDESC":
+		if len(args) != 3 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+			return
+		}
+		s.reply(sess, fmt.Sprintf("CMDDESC %s %s %s", ups, args[2], quote("Description unavailable")))
+	default:
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+	}
+}
+
+func (s *Server) handleList(sess *session, args []string) {
+	if len(args) == 0 {
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+		return
+	}
+	what := strings.ToUpper(args[0])
+
+	if what == "UPS" {
+		lines := []string{"BEGIN LIST UPS"}
+		for _, d := range s.devices {
+			lines = append(lines, fmt.Sprintf("UPS %s %s", d.Name, quote(s.description(d.Name))))
+		}
+		lines = append(lines, "END LIST UPS")
+		s.reply(sess, lines...)
+		return
+	}
+
+	if len(args) < 2 {
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+		return
+	}
+	ups := args[1]
+	if !s.known(ups) {
+		s.reply(sess, "ERR UNKNOWN-UPS")
+		return
+	}
+	header := fmt.Sprintf("LIST %s %s", what, ups)
+	if what == "ENUM" || what == "RANGE" {
+		if len(args) != 3 {
+			s.reply(sess, "ERR INVALID-ARGUMENT")
+			return
+		}
+		header += " " + args[2]
+	}
+
+	var lines []string
+	switch what {
+	case "VAR":
+		vars, err := s.variables(ups)
+		if err != "" {
+			s.reply(sess, err)
+			return
+		}
+		for _, v := range vars {
+			lines = append(lines, fmt.Sprintf("VAR %s %s %s", ups, v.name, quote(v.value)))
+		}
+	case "CMD":
+		if s.commander != nil {
+			for _, c := range s.commander.Commands(ups) {
+				lines = append(lines, fmt.Sprintf("CMD %s %s", ups, c))
+			}
+		}
+	case "CLIENT":
+		// client addresses are not tracked, only their count
+	case "RW", "ENUM", "RANGE":
+		// every variable is read only
+	default:
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+		return
+	}
+	s.reply(sess, append(append([]string{"BEGIN " + header}, lines...), "END "+header)...)
+}
+
+func (s *Server) handleInstCmd(ctx context.Context, sess *session, args []string) {
+	if len(args) < 2 {
+		s.reply(sess, "ERR INVALID-ARGUMENT")
+		return
+	}
+	ups, command := args[0], args[1]
+	if !s.known(ups) {
+		s.reply(sess, "ERR UNKNOWN-UPS")
+		return
+	}
+	if s.cfg.Username == "" || !s.authorized(sess) {
+		s.reply(sess, "ERR ACCESS-DENIED")
+		return
+	}
+	if s.commander == nil || !slices.Contains(s.commander.Commands(ups), command) {
+		s.reply(sess, "ERR CMD-NOT-SUPPORTED")
+		return
+	}
+	s.log.Infof("running instant command %s on %s for %s", command, ups, sess.username)
+
+	err := s.commander.Run(ctx, ups, command)
+	if err != nil {
+		s.log.Errorf("instant command %s on %s error: %s", command, ups, err)
+		s.reply(sess, "ERR INSTCMD-FAILED")
+		return
+	}
+	s.reply(sess, "OK")
+}
+
+// variables returns the NUT variables of the UPS, or the protocol error when
+// there is no fresh reading.
+func (s *Server) variables(ups string) ([]variable, string) {
+	reading, ok := s.store.Get(ups)
+	if !ok || time.Since(reading.GetAt) > s.cfg.MaxAge {
+		return nil, "ERR DATA-STALE"
+	}
+	vars := variables(reading, s.cfg.LowBattery)
+	if s.estimator != nil {
+		if runtime, ok := s.estimator.Runtime(ups); ok {
+			vars = append(vars, variable{name: "battery.runtime", value: format(runtime.Seconds())})
+			sortVariables(vars)
+		}
+	}
+	return vars, ""
+}
+
+func (s *Server) authorized(sess *session) bool {
+	if s.cfg.Username == "" {
+		return true
+	}
+	user := subtle.ConstantTimeCompare([]byte(sess.username), []byte(s.cfg.Username))
+	pass := subtle.ConstantTimeCompare([]byte(sess.password), []byte(s.cfg.Password))
+	return user&pass == 1
+}
+
+func (s *Server) known(ups string) bool {
+	for _, d := range s.devices {
+		if d.Name == ups {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) description(ups string) string {
+	if reading, ok := s.store.Get(ups); ok && reading.DeployName != "" {
+		return reading.DeployName
+	}
+	return "SMS UPS " + ups
+}
+
+func (s *Server) reply(sess *session, lines ...string) {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	_, err := sess.conn.Write([]byte(b.String()))
+	if err != nil {
+		s.log.Debugf("error writing to %s: %s", sess.conn.RemoteAddr(), err)
+	}
+}
+
+func varType(v variable) string {
+	if _, err := strconv.ParseFloat(v.value, 64); err == nil {
+		return "NUMBER"
+	}
+	return fmt.Sprintf("STRING:%d", len(v.value))
+}
+
+func varDescription(name string) string {
+	if desc, ok := descriptions[name]; ok {
+		return desc
+	}
+	return "Description unavailable"
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// split breaks a command line into its arguments, honoring double quotes and
+// backslash escapes.
+func split(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inQuote, escaped, hasArg := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case (r == ' ' || r == '\t' || r == '\r') && !inQuote:
+			if hasArg || cur.Len() > 0 {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuote || escaped {
+		return nil, fmt.Errorf("unterminated argument")
+	}
+	if hasArg || cur.Len() > 0 {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
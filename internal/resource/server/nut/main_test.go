@@ -0,0 +1,289 @@
+package nut
+
+import (
+	"bufio"
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type commander struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (c *commander) Commands(string) []string {
+	return []string{"test.battery.start", "test.battery.stop"}
+}
+
+func (c *commander) Run(_ context.Context, ups, command string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ran = append(c.ran, ups+" "+command)
+	return nil
+}
+
+func newTestServer(t *testing.T, cfg device.Nut, cmd Commander) *Server {
+	t.Helper()
+	store := latest.NewStore()
+	err := store.Write(context.Background(), device.Reading{
+		Device:     "rack",
+		GetAt:      time.Now(),
+		DeployName: "Rack \"A\"",
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: 95},
+			device.QuantityLoad:         {Value: 30.5},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = time.Minute
+	}
+	return &Server{
+		log:       logger.NewLogger(),
+		cfg:       cfg,
+		store:     store,
+		devices:   []device.Device{{Name: "rack"}, {Name: "spare"}},
+		commander: cmd,
+		logins:    make(map[string]int),
+	}
+}
+
+// client talks to the server over a pipe.
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, s *Server) *client {
+	t.Helper()
+	conn, server := net.Pipe()
+	go s.serve(context.Background(), server)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send writes the command and returns the lines of its reply, up to the END
+// of a list.
+func (c *client) send(command string) []string {
+	c.t.Helper()
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.conn.Write([]byte(command + "\n"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("%s: %s", command, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		lines = append(lines, line)
+		if !strings.HasPrefix(lines[0], "BEGIN ") || strings.HasPrefix(line, "END ") {
+			return lines
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  bool
+	}{
+		{line: "LIST VAR rack", want: []string{"LIST", "VAR", "rack"}},
+		{line: "  GET   VAR\track ups.status\r", want: []string{"GET", "VAR", "rack", "ups.status"}},
+		{line: `PASSWORD "with space"`, want: []string{"PASSWORD", "with space"}},
+		{line: `PASSWORD ""`, want: []string{"PASSWORD", ""}},
+		{line: `PASSWORD a\"b\\c`, want: []string{"PASSWORD", `a"b\c`}},
+		{line: `PASSWORD "open`, err: true},
+		{line: `PASSWORD trailing\`, err: true},
+		{line: "", want: nil},
+	}
+	for _, tt := range tests {
+		got, err := split(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.line)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: %q (%v), want %q", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		values map[string]float64
+		want   string
+	}{
+		{values: map[string]float64{"on_grid": 1, "battery_is_full": 1}, want: "OL"},
+		{values: map[string]float64{"on_grid": 1, "battery_is_full": 0}, want: "OL CHRG"},
+		{values: map[string]float64{"on_grid": 0, "battery_level": 50}, want: "OB"},
+		{values: map[string]float64{"on_grid": 0, "battery_level": 20, "battery_is_full": 0}, want: "OB LB"},
+		{values: map[string]float64{"battery_level": 10}, want: ""},
+		{values: map[string]float64{"on_grid": 1, "battery_fail": 1, "on_bypass": 1, "on_boost": 1, "on_high_power": 1}, want: "OL RB BYPASS BOOST OVER"},
+	}
+	for _, tt := range tests {
+		if got := status(tt.values, 20); got != tt.want {
+			t.Errorf("%v: status %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	c := dial(t, newTestServer(t, device.Nut{LowBattery: 20}, &commander{}))
+
+	want := []string{"BEGIN LIST UPS", `UPS rack "Rack \"A\""`, `UPS spare "SMS UPS spare"`, "END LIST UPS"}
+	if got := c.send("LIST UPS"); !slices.Equal(got, want) {
+		t.Errorf("LIST UPS: %q, want %q", got, want)
+	}
+
+	vars := c.send("LIST VAR rack")
+	if vars[0] != "BEGIN LIST VAR rack" || vars[len(vars)-1] != "END LIST VAR rack" {
+		t.Fatalf("LIST VAR: %q", vars)
+	}
+	for _, line := range []string{`VAR rack battery.charge "95"`, `VAR rack ups.load "30.5"`, `VAR rack ups.status "OL"`, `VAR rack battery.charge.low "20"`} {
+		if !slices.Contains(vars, line) {
+			t.Errorf("LIST VAR: no %s in %q", line, vars)
+		}
+	}
+	if !slices.IsSorted(vars[1 : len(vars)-1]) {
+		t.Errorf("LIST VAR: not sorted %q", vars)
+	}
+
+	want = []string{"BEGIN LIST CMD rack", "CMD rack test.battery.start", "CMD rack test.battery.stop", "END LIST CMD rack"}
+	if got := c.send("list cmd rack"); !slices.Equal(got, want) {
+		t.Errorf("LIST CMD: %q, want %q", got, want)
+	}
+	if got := c.send("LIST RW rack"); !slices.Equal(got, []string{"BEGIN LIST RW rack", "END LIST RW rack"}) {
+		t.Errorf("LIST RW: %q, want an empty list", got)
+	}
+
+	tests := map[string]string{
+		"LIST VAR spare": "ERR DATA-STALE",
+		"LIST VAR other": "ERR UNKNOWN-UPS",
+		"LIST ENUM rack": "ERR INVALID-ARGUMENT",
+		"LIST":           "ERR INVALID-ARGUMENT",
+	}
+	for command, want := range tests {
+		if got := c.send(command); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: %q, want %s", command, got, want)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	s := newTestServer(t, device.Nut{}, nil)
+	c := dial(t, s)
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "GET VAR rack battery.charge", want: `VAR rack battery.charge "95"`},
+		{command: "GET TYPE rack battery.charge", want: "TYPE rack battery.charge NUMBER"},
+		{command: "GET TYPE rack ups.status", want: "TYPE rack ups.status STRING:2"},
+		{command: "GET DESC rack ups.load", want: `DESC rack ups.load "Load on UPS (percent of full)"`},
+		{command: "GET UPSDESC rack", want: `UPSDESC rack "Rack \"A\""`},
+		{command: "GET VAR rack battery.runtime", want: "ERR VAR-NOT-SUPPORTED"},
+		{command: "GET VAR spare ups.status", want: "ERR DATA-STALE"},
+		{command: "GET VAR other ups.status", want: "ERR UNKNOWN-UPS"},
+		{command: "GET VAR rack", want: "ERR INVALID-ARGUMENT"},
+		{command: "GET NUMLOGINS rack", want: "NUMLOGINS rack 0"},
+		{command: "LOGIN rack", want: "OK"},
+		{command: "GET NUMLOGINS rack", want: "NUMLOGINS rack 1"},
+		{command: "SET VAR rack ups.id x", want: "ERR READONLY"},
+		{command: "GET VAR rack \"unterminated", want: "ERR INVALID-ARGUMENT"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.command); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: %q, want %s", tt.command, got, tt.want)
+		}
+	}
+
+	// the login is released with the connection
+	_ = c.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := s.logins["rack"]
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d logins left after closing the connection", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInstCmd(t *testing.T) {
+	cmd := &commander{}
+	s := newTestServer(t, device.Nut{Username: "upsmon", Password: "secret"}, cmd)
+
+	c := dial(t, s)
+	if got := c.send("INSTCMD rack test.battery.start"); got[0] != "ERR ACCESS-DENIED" {
+		t.Errorf("without a login: %q", got)
+	}
+	c.send("USERNAME upsmon")
+	c.send("PASSWORD wrong")
+	if got := c.send("INSTCMD rack test.battery.start"); got[0] != "ERR ACCESS-DENIED" {
+		t.Errorf("with a wrong password: %q", got)
+	}
+
+	c = dial(t, s)
+	c.send("USERNAME upsmon")
+	c.send("PASSWORD secret")
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "INSTCMD rack test.battery.start", want: "OK"},
+		{command: "INSTCMD rack shutdown.return", want: "ERR CMD-NOT-SUPPORTED"},
+		{command: "INSTCMD other test.battery.start", want: "ERR UNKNOWN-UPS"},
+		{command: "INSTCMD rack", want: "ERR INVALID-ARGUMENT"},
+	}
+	for _, tt := range tests {
+		if got := c.send(tt.command); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: %q, want %s", tt.command, got, tt.want)
+		}
+	}
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+	if want := []string{"rack test.battery.start"}; !slices.Equal(cmd.ran, want) {
+		t.Errorf("ran %q, want %q", cmd.ran, want)
+	}
+}
+
+func TestInstCmdWithoutUsers(t *testing.T) {
+	cmd := &commander{}
+	c := dial(t, newTestServer(t, device.Nut{}, cmd))
+
+	// commands need a configured user, even when reading does not
+	if got := c.send("INSTCMD rack test.battery.start"); got[0] != "ERR ACCESS-DENIED" {
+		t.Errorf("without users: %q", got)
+	}
+	if len(cmd.ran) > 0 {
+		t.Errorf("ran %q", cmd.ran)
+	}
+}
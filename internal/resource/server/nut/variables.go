@@ -0,0 +1,124 @@
+package nut
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gauges maps the exported metric names to the standard NUT variables.
+var gauges = map[string]string{
+	"battery_level":    "battery.charge",
+	"input_voltage":    "input.voltage",
+	"output_voltage":   "output.voltage",
+	"output_frequency": "output.frequency",
+	"ups_load":         "ups.load",
+	"ups_temperature":  "ups.temperature",
+}
+
+var descriptions = map[string]string{
+	"battery.charge":     "Battery charge (percent of full)",
+	"battery.charge.low": "Remaining battery level when UPS switches to LB (percent)",
+	"battery.runtime":    "Battery runtime (seconds)",
+	"input.voltage":      "Input voltage (V)",
+	"output.voltage":     "Output voltage (V)",
+	"output.frequency":   "Output frequency (Hz)",
+	"ups.load":           "Load on UPS (percent of full)",
+	"ups.temperature":    "UPS temperature (degrees C)",
+	"ups.status":         "UPS status",
+	"ups.mfr":            "UPS manufacturer",
+	"ups.model":          "UPS model",
+	"ups.id":             "UPS system identifier",
+	"device.mfr":         "Description unavailable",
+	"device.model":       "Description unavailable",
+	"device.type":        "Description unavailable",
+	"device.description": "Description unavailable",
+	"driver.name":        "Driver name",
+	"driver.version":     "Driver version - NUT release",
+}
+
+type variable struct {
+	name  string
+	value string
+}
+
+// variables translates the UPS reading to NUT variables, sorted by name.
+func variables(reading device.Reading, lowBattery float64) []variable {
+	values := reading.Values()
+	vars := map[string]string{
+		"device.mfr":         "SMS",
+		"device.model":       reading.UPSType,
+		"device.type":        "ups",
+		"device.description": reading.DeployName,
+		"ups.mfr":            "SMS",
+		"ups.model":          reading.UPSType,
+		"ups.id":             reading.DeployID,
+		"ups.status":         status(values, lowBattery),
+		"battery.charge.low": format(lowBattery),
+		"driver.name":        "ups-metrics",
+		"driver.version":     logger.Version,
+	}
+	for name, nut := range gauges {
+		if v, ok := values[name]; ok {
+			vars[nut] = format(v)
+		}
+	}
+
+	list := make([]variable, 0, len(vars))
+	for name, value := range vars {
+		if value == "" {
+			continue
+		}
+		list = append(list, variable{name: name, value: value})
+	}
+	sortVariables(list)
+	return list
+}
+
+func sortVariables(list []variable) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+}
+
+// status builds ups.status from the UPS states: OL or OB, LB when on battery
+// under the low battery level, and CHRG, RB, BYPASS, BOOST and OVER flags.
+// Neither OL nor OB is set when the grid state was not reported, as OB and LB
+// make upsmon shut hosts down.
+func status(values map[string]float64, lowBattery float64) string {
+	var flags []string
+
+	grid, reported := values["on_grid"]
+	onGrid := reported && grid == 1
+	switch {
+	case onGrid:
+		flags = append(flags, "OL")
+	case reported:
+		flags = append(flags, "OB")
+		if level, ok := values["battery_level"]; ok && level <= lowBattery {
+			flags = append(flags, "LB")
+		}
+	}
+	if full, ok := values["battery_is_full"]; ok && full == 0 && onGrid {
+		flags = append(flags, "CHRG")
+	}
+	if values["battery_fail"] == 1 {
+		flags = append(flags, "RB")
+	}
+	if values["on_bypass"] == 1 {
+		flags = append(flags, "BYPASS")
+	}
+	if values["on_boost"] == 1 {
+		flags = append(flags, "BOOST")
+	}
+	if values["on_high_power"] == 1 {
+		flags = append(flags, "OVER")
+	}
+	return strings.Join(flags, " ")
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
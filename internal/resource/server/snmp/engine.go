@@ -0,0 +1,77 @@
+package snmp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const engineStateFile = `snmp-engine.yaml`
+
+// enterprisePrefix starts the generated engine ids, RFC 3411 format 5
+// (administratively assigned octets) under the net-snmp enterprise number.
+var enterprisePrefix = []byte{0x80, 0x00, 0x1f, 0x88, 0x05}
+
+type engineState struct {
+	EngineID string `yaml:"engine_id"`
+	Boots    uint32 `yaml:"boots"`
+}
+
+// loadEngine returns the engine id and increments snmpEngineBoots, which
+// SNMPv3 requires to grow on every restart so old messages can not be
+// replayed. A random engine id is generated and kept when none is configured.
+func loadEngine(dir string, configured string) (string, uint32, error) {
+	path := filepath.Join(dir, engineStateFile)
+
+	var state engineState
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return "", 0, fmt.Errorf("reading %s: %w", path, err)
+	default:
+		err = yaml.Unmarshal(data, &state)
+		if err != nil {
+			return "", 0, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	if configured != "" {
+		state.EngineID = configured
+	}
+	if state.EngineID == "" {
+		id := make([]byte, 8)
+		_, err = rand.Read(id)
+		if err != nil {
+			return "", 0, err
+		}
+		state.EngineID = hex.EncodeToString(append(enterprisePrefix, id...))
+	}
+	id, err := hex.DecodeString(state.EngineID)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid engine id %s: %w", state.EngineID, err)
+	}
+	if len(id) < 5 || len(id) > 32 {
+		return "", 0, fmt.Errorf("invalid engine id %s: must have from 5 to 32 bytes", state.EngineID)
+	}
+	if state.Boots < math.MaxInt32 {
+		state.Boots++
+	}
+
+	data, err = yaml.Marshal(state)
+	if err != nil {
+		return "", 0, err
+	}
+	err = utils.WriteFileAtomic(path, data, 0o600)
+	if err != nil {
+		return "", 0, fmt.Errorf("writing %s: %w", path, err)
+	}
+	return string(id), state.Boots, nil
+}
@@ -0,0 +1,329 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"github.com/gosnmp/gosnmp"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRepetitions = 100
+	maxPacketSize  = 65535
+)
+
+// Server is a SNMPv2c and SNMPv3 agent serving the UPS-MIB (RFC 1628) with the
+// last readings of the devices, so network management systems can poll them
+// like any other UPS. The configured device is served by default, others are
+// selected by the SNMPv3 context name or a "community@device" community.
+//
+// It is also a notification sink: power failures feed upsInputLineBads and
+// upsSecondsOnBattery, and shutdown events raise upsAlarmShutdownPending.
+type Server struct {
+	log       *logger.Logger
+	cfg       device.Snmp
+	store     *latest.Store
+	estimator device.RuntimeEstimator
+	devices   map[string]bool
+	users     map[string]*user
+	v2c       *gosnmp.GoSNMP
+	v3        *gosnmp.GoSNMP
+	discovery *gosnmp.GoSNMP
+	engineID  string
+	boots     uint32
+	started   time.Time
+
+	mu               sync.Mutex
+	unknownEngineIDs uint32
+	notInTimeWindows uint32
+	state            map[string]*events
+	since            map[string]map[int]uint32
+}
+
+// events keeps what the notifications tell about a device.
+type events struct {
+	lineBads       uint32
+	onBatterySince time.Time
+	shutdown       bool
+}
+
+func NewServer(l *application.Application, store *latest.Store, estimator device.RuntimeEstimator) (*Server, error) {
+	return newServer(l.Log.With("server", "snmp"), l.Config.GetServersConfig().Snmp, l.Config.GetStateDir(), l.Config.GetDevices(), store, estimator)
+}
+
+func newServer(log *logger.Logger, cfg device.Snmp, stateDir string, devices []device.Device, store *latest.Store, estimator device.RuntimeEstimator) (*Server, error) {
+	if cfg.Community == "" && len(cfg.Users) == 0 {
+		return nil, fmt.Errorf("snmp server: a community or at least one user is required")
+	}
+
+	engineID, boots, err := loadEngine(stateDir, cfg.EngineID)
+	if err != nil {
+		return nil, fmt.Errorf("snmp server: %w", err)
+	}
+
+	s := &Server{
+		log:       log,
+		cfg:       cfg,
+		store:     store,
+		estimator: estimator,
+		devices:   make(map[string]bool),
+		users:     make(map[string]*user),
+		v2c:       &gosnmp.GoSNMP{Version: gosnmp.Version2c},
+		engineID:  engineID,
+		boots:     boots,
+		started:   time.Now(),
+		state:     make(map[string]*events),
+		since:     make(map[string]map[int]uint32),
+	}
+	for _, d := range devices {
+		s.devices[d.Name] = true
+	}
+
+	table := gosnmp.NewSnmpV3SecurityParametersTable(gosnmp.Logger{})
+	for _, u := range cfg.Users {
+		usr, err := newUser(u, engineID)
+		if err != nil {
+			return nil, err
+		}
+		s.users[u.Username] = usr
+		err = table.Add(u.Username, usr.params.Copy())
+		if err != nil {
+			return nil, fmt.Errorf("snmp user %s: %w", u.Username, err)
+		}
+	}
+	s.v3 = &gosnmp.GoSNMP{
+		Version:                     gosnmp.Version3,
+		SecurityModel:               gosnmp.UserSecurityModel,
+		TrapSecurityParametersTable: table,
+	}
+	s.discovery = &gosnmp.GoSNMP{
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{},
+	}
+	return s, nil
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("snmp server: %w", err)
+	}
+	s.log.Infof("SNMP agent listening on %s (engine id %x, boots %d)", s.cfg.Listen, s.engineID, s.boots)
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	return s.serve(ctx, conn)
+}
+
+func (s *Server) serve(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				s.log.Infof("stopping snmp server...")
+				return context.Canceled
+			}
+			return fmt.Errorf("snmp server: %w", err)
+		}
+		response := s.handle(buf[:n])
+		if response == nil {
+			continue
+		}
+		_, err = conn.WriteTo(response, addr)
+		if err != nil {
+			s.log.Debugf("snmp response to %s: %s", addr, err)
+		}
+	}
+}
+
+// handle answers a single request, returning nil when nothing must be sent.
+func (s *Server) handle(msg []byte) []byte {
+	var response *gosnmp.SnmpPacket
+
+	v, ok := version(msg)
+	if !ok {
+		return nil
+	}
+	switch v {
+	case gosnmp.Version2c:
+		if s.cfg.Community == "" {
+			return nil
+		}
+		request, err := s.v2c.UnmarshalTrap(clone(msg), false)
+		if err != nil {
+			s.log.Debugf("dropping snmpv2c request: %s", err)
+			return nil
+		}
+		community, name, _ := strings.Cut(request.Community, "@")
+		if community != s.cfg.Community {
+			s.log.Debugf("dropping snmpv2c request with wrong community")
+			return nil
+		}
+		name, ok := s.device(name)
+		if !ok {
+			return nil
+		}
+		response = &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: request.Community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: request.RequestID,
+		}
+		s.answer(name, request, response)
+	case gosnmp.Version3:
+		if len(s.users) == 0 {
+			return nil
+		}
+		request, report := s.decodeV3(msg)
+		if report != nil {
+			response = report
+			break
+		}
+		if request == nil {
+			return nil
+		}
+		name, ok := s.device(request.ContextName)
+		if !ok {
+			s.log.Debugf("dropping snmpv3 request for unknown context %q", request.ContextName)
+			return nil
+		}
+		params, ok := request.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok {
+			return nil
+		}
+		response = s.responseV3(request, params, nil)
+		s.answer(name, request, response)
+	default:
+		return nil
+	}
+
+	err := s.secure(response)
+	if err != nil {
+		s.log.Errorf("snmp response: %s", err)
+		return nil
+	}
+	out, err := response.MarshalMsg()
+	if err != nil {
+		s.log.Errorf("snmp response: %s", err)
+		return nil
+	}
+	return out
+}
+
+// answer fills the response variables, refusing every Set as the MIB is
+// read only.
+func (s *Server) answer(name string, request, response *gosnmp.SnmpPacket) {
+	switch request.PDUType {
+	case gosnmp.GetRequest, gosnmp.GetNextRequest, gosnmp.GetBulkRequest:
+		response.Variables = get(s.mib(name), request)
+	case gosnmp.SetRequest:
+		response.Variables = request.Variables
+		response.Error = gosnmp.NotWritable
+		response.ErrorIndex = 1
+	default:
+		response.Variables = request.Variables
+		response.Error = gosnmp.GenErr
+	}
+}
+
+// device returns the device selected by a context, the configured device
+// when empty.
+func (s *Server) device(name string) (string, bool) {
+	if name == "" {
+		return s.cfg.Device, true
+	}
+	return name, s.devices[name]
+}
+
+// Send keeps the device events used by the MIB.
+func (s *Server) Send(ctx context.Context, notification device.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.eventsLocked(notification.Device)
+	switch notification.Type {
+	case device.EventPowerFailure:
+		e.lineBads++
+		if e.onBatterySince.IsZero() {
+			e.onBatterySince = time.Now()
+		}
+	case device.EventPowerRestored:
+		e.onBatterySince = time.Time{}
+		e.shutdown = false
+	case device.EventShutdown, device.EventShutdownScheduled:
+		e.shutdown = true
+	case device.EventShutdownCancelled:
+		e.shutdown = false
+	}
+	return nil
+}
+
+func (s *Server) events(name string) events {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.eventsLocked(name)
+}
+
+func (s *Server) eventsLocked(name string) *events {
+	e, ok := s.state[name]
+	if !ok {
+		e = &events{}
+		s.state[name] = e
+	}
+	return e
+}
+
+// alarms returns the sysUpTime when each present alarm was first seen,
+// forgetting the alarms that cleared.
+func (s *Server) alarms(name string, present []int, uptime uint32) map[int]uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.since[name]
+	since := make(map[int]uint32, len(present))
+	for _, id := range present {
+		if t, ok := last[id]; ok {
+			since[id] = t
+		} else {
+			since[id] = uptime
+		}
+	}
+	s.since[name] = since
+	return since
+}
+
+// uptime is sysUpTime, in hundredths of a second.
+func (s *Server) uptime() uint32 {
+	return uint32(time.Since(s.started) / (10 * time.Millisecond))
+}
+
+// engineTime is snmpEngineTime, in seconds.
+func (s *Server) engineTime() uint32 {
+	return uint32(time.Since(s.started) / time.Second)
+}
+
+// version reads the SNMP version of a message, false when it is not valid.
+func version(msg []byte) (gosnmp.SnmpVersion, bool) {
+	if len(msg) < 2 || msg[0] != 0x30 {
+		return 0, false
+	}
+	cursor := 2
+	if msg[1] > 0x80 {
+		cursor += int(msg[1] & 0x7f)
+	}
+	if len(msg) < cursor+3 || msg[cursor] != 0x02 || msg[cursor+1] != 0x01 {
+		return 0, false
+	}
+	return gosnmp.SnmpVersion(msg[cursor+2]), true
+}
@@ -0,0 +1,258 @@
+package snmp
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"github.com/gosnmp/gosnmp"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+const sysName = system + ".5.0"
+
+var monitor = device.SnmpUser{
+	Username:     "monitor",
+	AuthProtocol: "sha",
+	AuthPassword: "auth-secret",
+	PrivProtocol: "aes",
+	PrivPassword: "priv-secret",
+}
+
+// newTestServer serves the rack and spare devices on a local port, with the
+// public community and the monitor user.
+func newTestServer(t *testing.T) (*Server, uint16) {
+	t.Helper()
+	store := latest.NewStore()
+	err := store.Write(context.Background(), device.Reading{
+		Device: "rack",
+		GetAt:  time.Now(),
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: 95},
+			device.QuantityLoad:         {Value: 30},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := device.Snmp{
+		Device:     "rack",
+		Community:  "public",
+		Users:      []device.SnmpUser{monitor},
+		LowBattery: 20,
+		MaxAge:     time.Minute,
+	}
+	s, err := newServer(logger.NewLogger(), cfg, t.TempDir(), []device.Device{{Name: "rack"}, {Name: "spare"}}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		_ = conn.Close()
+	})
+	go func() {
+		_ = s.serve(ctx, conn)
+	}()
+	return s, uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func connect(t *testing.T, client *gosnmp.GoSNMP, port uint16) *gosnmp.GoSNMP {
+	t.Helper()
+	client.Target = "127.0.0.1"
+	client.Port = port
+	client.Timeout = 300 * time.Millisecond
+	client.Retries = 0
+	err := client.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Conn.Close()
+	})
+	return client
+}
+
+func v2c(t *testing.T, port uint16, community string) *gosnmp.GoSNMP {
+	t.Helper()
+	return connect(t, &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: community}, port)
+}
+
+func v3(t *testing.T, port uint16, u device.SnmpUser, contextName string) *gosnmp.GoSNMP {
+	t.Helper()
+	return connect(t, &gosnmp.GoSNMP{
+		Version:       gosnmp.Version3,
+		SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags:      gosnmp.AuthPriv,
+		ContextName:   contextName,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{
+			UserName:                 u.Username,
+			AuthenticationProtocol:   authProtocols[u.AuthProtocol],
+			AuthenticationPassphrase: u.AuthPassword,
+			PrivacyProtocol:          privProtocols[u.PrivProtocol],
+			PrivacyPassphrase:        u.PrivPassword,
+		},
+	}, port)
+}
+
+// name returns sysName, the device the request was answered for.
+func name(t *testing.T, client *gosnmp.GoSNMP) (string, error) {
+	t.Helper()
+	result, err := client.Get([]string{sysName})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Variables) != 1 || result.Variables[0].Type != gosnmp.OctetString {
+		t.Fatalf("sysName answered %+v", result.Variables)
+	}
+	return string(result.Variables[0].Value.([]byte)), nil
+}
+
+func TestCommunity(t *testing.T) {
+	_, port := newTestServer(t)
+
+	tests := []struct {
+		community string
+		want      string
+	}{
+		{community: "public", want: "rack"},
+		{community: "public@spare", want: "spare"},
+		{community: "public@rack", want: "rack"},
+		{community: "private"},
+		{community: "private@spare"},
+		{community: "public@other"},
+	}
+	for _, tt := range tests {
+		got, err := name(t, v2c(t, port, tt.community))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: answered for %s, want no answer", tt.community, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: answered for %q (%v), want %s", tt.community, got, err, tt.want)
+		}
+	}
+}
+
+func TestV3(t *testing.T) {
+	s, port := newTestServer(t)
+
+	client := v3(t, port, monitor, "spare")
+	got, err := name(t, client)
+	if err != nil || got != "spare" {
+		t.Fatalf("answered for %q (%v), want spare", got, err)
+	}
+	// the client learned the engine from the discovery report
+	params := client.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if params.AuthoritativeEngineID != s.engineID || params.AuthoritativeEngineBoots != s.boots {
+		t.Errorf("discovered engine %x boots %d, want %x boots %d", params.AuthoritativeEngineID, params.AuthoritativeEngineBoots, s.engineID, s.boots)
+	}
+	s.mu.Lock()
+	reports := s.unknownEngineIDs
+	s.mu.Unlock()
+	if reports != 1 {
+		t.Errorf("%d discovery reports, want 1", reports)
+	}
+
+	got, err = name(t, v3(t, port, monitor, ""))
+	if err != nil || got != "rack" {
+		t.Errorf("without a context answered for %q (%v), want rack", got, err)
+	}
+	_, err = name(t, v3(t, port, monitor, "other"))
+	if err == nil {
+		t.Error("answered for an unknown context")
+	}
+}
+
+func TestV3BadAuth(t *testing.T) {
+	_, port := newTestServer(t)
+
+	wrongAuth := monitor
+	wrongAuth.AuthPassword = "not-the-secret"
+	wrongPriv := monitor
+	wrongPriv.PrivPassword = "not-the-secret"
+	unknown := monitor
+	unknown.Username = "intruder"
+
+	for _, u := range []device.SnmpUser{wrongAuth, wrongPriv, unknown} {
+		got, err := name(t, v3(t, port, u, ""))
+		if err == nil {
+			t.Errorf("user %s: answered for %s", u.Username, got)
+		}
+	}
+
+	// a lower security level than configured is dropped too
+	client := v3(t, port, monitor, "")
+	client.MsgFlags = gosnmp.AuthNoPriv
+	got, err := name(t, client)
+	if err == nil {
+		t.Errorf("without privacy: answered for %s", got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	_, port := newTestServer(t)
+	client := v2c(t, port, "public")
+
+	var walked [][]int
+	err := client.Walk(".1.3.6.1.2.1", func(pdu gosnmp.SnmpPDU) error {
+		walked = append(walked, parseOID(pdu.Name))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) == 0 {
+		t.Fatal("nothing walked")
+	}
+	if !slices.IsSortedFunc(walked, slices.Compare[[]int]) {
+		t.Errorf("walked out of order: %v", walked)
+	}
+	for i := 1; i < len(walked); i++ {
+		if slices.Equal(walked[i-1], walked[i]) {
+			t.Errorf("walked %v twice", walked[i])
+		}
+	}
+
+	var bulk [][]int
+	err = client.BulkWalk(".1.3.6.1.2.1", func(pdu gosnmp.SnmpPDU) error {
+		bulk = append(bulk, parseOID(pdu.Name))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(walked, bulk, slices.Equal[[]int]) {
+		t.Errorf("bulk walked %v, want %v", bulk, walked)
+	}
+
+	// the walk ends at the end of the MIB, and GETNEXT skips past the
+	// requested oid even when it is not an object
+	result, err := client.GetNext([]string{upsBattery})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Variables[0].Name; got != upsBattery+".1.0" {
+		t.Errorf("next of upsBattery is %s, want upsBatteryStatus", got)
+	}
+	result, err = client.GetNext([]string{".1.3.6.1.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Variables[0].Type; got != gosnmp.EndOfMibView {
+		t.Errorf("next past the MIB is %s, want endOfMibView", got)
+	}
+}
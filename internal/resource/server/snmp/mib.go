@@ -0,0 +1,295 @@
+package snmp
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/gosnmp/gosnmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	system  = ".1.3.6.1.2.1.1"
+	upsMIB  = ".1.3.6.1.2.1.33"
+	objects = upsMIB + ".1"
+
+	upsIdent   = objects + ".1"
+	upsBattery = objects + ".2"
+	upsInput   = objects + ".3"
+	upsOutput  = objects + ".4"
+	upsAlarm   = objects + ".6"
+
+	// upsWellKnownAlarms are the alarm descriptions of upsAlarmDescr.
+	upsWellKnownAlarms = upsAlarm + ".3"
+)
+
+// well known alarms of RFC 1628, also used as upsAlarmId so the id of an
+// alarm is kept while it is present.
+const (
+	alarmBatteryBad         = 1
+	alarmOnBattery          = 2
+	alarmLowBattery         = 3
+	alarmOutputOverload     = 8
+	alarmOnBypass           = 9
+	alarmCommunicationsLost = 20
+	alarmShutdownPending    = 22
+	alarmTestInProgress     = 24
+)
+
+// upsBatteryStatus values
+const (
+	batteryUnknown = 1
+	batteryNormal  = 2
+	batteryLow     = 3
+)
+
+// upsOutputSource values
+const (
+	sourceOther   = 1
+	sourceNormal  = 3
+	sourceBypass  = 4
+	sourceBattery = 5
+	sourceBooster = 6
+)
+
+type variable struct {
+	oid []int
+	pdu gosnmp.SnmpPDU
+}
+
+// mib returns the system group and the UPS-MIB objects of the device, sorted
+// by oid. Readings older than max_age are left out and reported by the
+// upsAlarmCommunicationsLost alarm.
+func (s *Server) mib(name string) []variable {
+	var vars []variable
+
+	add := func(oid string, kind gosnmp.Asn1BER, value any) {
+		vars = append(vars, variable{
+			oid: parseOID(oid),
+			pdu: gosnmp.SnmpPDU{Name: oid, Type: kind, Value: value},
+		})
+	}
+	integer := func(oid string, value float64) {
+		add(oid, gosnmp.Integer, int(math.Round(value)))
+	}
+
+	now := time.Now()
+	uptime := s.uptime()
+	reading, ok := s.store.Get(name)
+	fresh := ok && now.Sub(reading.GetAt) <= s.cfg.MaxAge
+
+	add(system+".1.0", gosnmp.OctetString, strings.TrimSpace("ups-metrics "+logger.Version+" "+reading.UPSType))
+	add(system+".2.0", gosnmp.ObjectIdentifier, upsMIB)
+	add(system+".3.0", gosnmp.TimeTicks, uptime)
+	add(system+".5.0", gosnmp.OctetString, name)
+
+	add(upsIdent+".1.0", gosnmp.OctetString, "SMS")
+	add(upsIdent+".2.0", gosnmp.OctetString, reading.UPSType)
+	add(upsIdent+".3.0", gosnmp.OctetString, "")
+	add(upsIdent+".4.0", gosnmp.OctetString, "ups-metrics "+logger.Version)
+	add(upsIdent+".5.0", gosnmp.OctetString, name)
+	add(upsIdent+".6.0", gosnmp.OctetString, reading.DeployName)
+
+	var alarms []int
+	values := map[string]float64{}
+	if fresh {
+		values = reading.Values()
+	} else {
+		alarms = append(alarms, alarmCommunicationsLost)
+	}
+	// only a reported grid state says the UPS is on battery, a missing one
+	// must not raise the on battery or low battery alarms
+	grid, gridReported := values["on_grid"]
+	onBattery := gridReported && grid != 1
+	level, hasLevel := values["battery_level"]
+	lowBattery := onBattery && hasLevel && level <= s.cfg.LowBattery
+
+	status := batteryUnknown
+	if fresh {
+		status = batteryNormal
+		if lowBattery {
+			status = batteryLow
+		}
+	}
+	add(upsBattery+".1.0", gosnmp.Integer, status)
+
+	events := s.events(name)
+	if fresh {
+		seconds := 0
+		if onBattery && !events.onBatterySince.IsZero() {
+			seconds = int(now.Sub(events.onBatterySince).Seconds())
+		}
+		add(upsBattery+".2.0", gosnmp.Integer, seconds)
+
+		if s.estimator != nil {
+			if runtime, ok := s.estimator.Runtime(name); ok {
+				// upsEstimatedMinutesRemaining
+				integer(upsBattery+".3.0", runtime.Minutes())
+			}
+		}
+	}
+	if hasLevel {
+		integer(upsBattery+".4.0", level)
+	}
+	if v, ok := values["ups_temperature"]; ok {
+		integer(upsBattery+".7.0", v)
+	}
+
+	add(upsInput+".1.0", gosnmp.Counter32, events.lineBads)
+	add(upsInput+".2.0", gosnmp.Integer, 1)
+	if v, ok := values["input_voltage"]; ok {
+		add(upsInput+".3.1.1.1", gosnmp.Integer, 1)
+		integer(upsInput+".3.1.3.1", v)
+	}
+
+	if fresh {
+		source := sourceNormal
+		switch {
+		case onBattery:
+			source = sourceBattery
+		case values["on_bypass"] == 1:
+			source = sourceBypass
+		case values["on_boost"] == 1:
+			source = sourceBooster
+		case !gridReported:
+			source = sourceOther
+		}
+		add(upsOutput+".1.0", gosnmp.Integer, source)
+	} else {
+		add(upsOutput+".1.0", gosnmp.Integer, sourceOther)
+	}
+	if v, ok := values["output_frequency"]; ok {
+		// 0.1 Hertz
+		integer(upsOutput+".2.0", v*10)
+	}
+	add(upsOutput+".3.0", gosnmp.Integer, 1)
+	voltage, hasVoltage := values["output_voltage"]
+	load, hasLoad := values["ups_load"]
+	if hasVoltage || hasLoad {
+		add(upsOutput+".4.1.1.1", gosnmp.Integer, 1)
+	}
+	if hasVoltage {
+		integer(upsOutput+".4.1.2.1", voltage)
+	}
+	if hasLoad {
+		integer(upsOutput+".4.1.5.1", load)
+	}
+
+	if fresh {
+		if values["battery_fail"] == 1 {
+			alarms = append(alarms, alarmBatteryBad)
+		}
+		if onBattery {
+			alarms = append(alarms, alarmOnBattery)
+		}
+		if lowBattery {
+			alarms = append(alarms, alarmLowBattery)
+		}
+		if values["on_high_power"] == 1 {
+			alarms = append(alarms, alarmOutputOverload)
+		}
+		if values["on_bypass"] == 1 {
+			alarms = append(alarms, alarmOnBypass)
+		}
+		if onBattery && events.shutdown {
+			alarms = append(alarms, alarmShutdownPending)
+		}
+		if values["on_test"] == 1 {
+			alarms = append(alarms, alarmTestInProgress)
+		}
+	}
+	since := s.alarms(name, alarms, uptime)
+
+	add(upsAlarm+".1.0", gosnmp.Gauge32, uint32(len(alarms)))
+	for _, column := range []int{1, 2, 3} {
+		for _, id := range alarms {
+			oid := upsAlarm + ".2.1." + strconv.Itoa(column) + "." + strconv.Itoa(id)
+			switch column {
+			case 1:
+				add(oid, gosnmp.Integer, id)
+			case 2:
+				add(oid, gosnmp.ObjectIdentifier, upsWellKnownAlarms+"."+strconv.Itoa(id))
+			case 3:
+				add(oid, gosnmp.TimeTicks, since[id])
+			}
+		}
+	}
+
+	slices.SortFunc(vars, func(a, b variable) int {
+		return slices.Compare(a.oid, b.oid)
+	})
+	return vars
+}
+
+// get answers a Get, GetNext or GetBulk request from the device objects.
+func get(vars []variable, request *gosnmp.SnmpPacket) []gosnmp.SnmpPDU {
+	var out []gosnmp.SnmpPDU
+
+	switch request.PDUType {
+	case gosnmp.GetRequest:
+		for _, v := range request.Variables {
+			out = append(out, exact(vars, v.Name))
+		}
+	case gosnmp.GetNextRequest:
+		for _, v := range request.Variables {
+			out = append(out, next(vars, v.Name))
+		}
+	case gosnmp.GetBulkRequest:
+		nonRepeaters := min(int(request.NonRepeaters), len(request.Variables))
+		for _, v := range request.Variables[:nonRepeaters] {
+			out = append(out, next(vars, v.Name))
+		}
+		repeaters := request.Variables[nonRepeaters:]
+		last := make([]string, len(repeaters))
+		for i, v := range repeaters {
+			last[i] = v.Name
+		}
+		for r := 0; r < min(int(request.MaxRepetitions), maxRepetitions) && len(repeaters) > 0; r++ {
+			ended := true
+			for i := range repeaters {
+				pdu := next(vars, last[i])
+				out = append(out, pdu)
+				last[i] = pdu.Name
+				ended = ended && pdu.Type == gosnmp.EndOfMibView
+			}
+			if ended {
+				break
+			}
+		}
+	}
+	return out
+}
+
+func exact(vars []variable, name string) gosnmp.SnmpPDU {
+	oid := parseOID(name)
+	for _, v := range vars {
+		if slices.Equal(v.oid, oid) {
+			return v.pdu
+		}
+	}
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.NoSuchObject}
+}
+
+func next(vars []variable, name string) gosnmp.SnmpPDU {
+	oid := parseOID(name)
+	for _, v := range vars {
+		if slices.Compare(v.oid, oid) > 0 {
+			return v.pdu
+		}
+	}
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.EndOfMibView}
+}
+
+func parseOID(name string) []int {
+	var oid []int
+	for _, part := range strings.Split(strings.Trim(name, "."), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		oid = append(oid, n)
+	}
+	return oid
+}
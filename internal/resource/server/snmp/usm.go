@@ -0,0 +1,192 @@
+package snmp
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/gosnmp/gosnmp"
+	"strings"
+)
+
+const (
+	usmStatsNotInTimeWindows = ".1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownEngineIDs = ".1.3.6.1.6.3.15.1.1.4.0"
+
+	// timeWindow is the accepted difference between the engine time of a
+	// request and the agent, RFC 3414 section 3.2.7.
+	timeWindow = 150
+)
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"":       gosnmp.NoAuth,
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"":        gosnmp.NoPriv,
+	"des":     gosnmp.DES,
+	"aes":     gosnmp.AES,
+	"aes192":  gosnmp.AES192,
+	"aes256":  gosnmp.AES256,
+	"aes192c": gosnmp.AES192C,
+	"aes256c": gosnmp.AES256C,
+}
+
+// user is a configured SNMPv3 user with its keys localized to the agent
+// engine id. It also allocates the privacy salt of every response.
+type user struct {
+	params *gosnmp.UsmSecurityParameters
+	level  gosnmp.SnmpV3MsgFlags
+}
+
+func newUser(cfg device.SnmpUser, engineID string) (*user, error) {
+	auth, ok := authProtocols[strings.ToLower(cfg.AuthProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("snmp user %s: unknown auth protocol %s", cfg.Username, cfg.AuthProtocol)
+	}
+	priv, ok := privProtocols[strings.ToLower(cfg.PrivProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("snmp user %s: unknown priv protocol %s", cfg.Username, cfg.PrivProtocol)
+	}
+
+	level := gosnmp.NoAuthNoPriv
+	if auth != gosnmp.NoAuth {
+		level = gosnmp.AuthNoPriv
+		if cfg.AuthPassword == "" {
+			return nil, fmt.Errorf("snmp user %s: auth_password is required", cfg.Username)
+		}
+	}
+	if priv != gosnmp.NoPriv {
+		if auth == gosnmp.NoAuth {
+			return nil, fmt.Errorf("snmp user %s: priv_protocol requires an auth_protocol", cfg.Username)
+		}
+		if cfg.PrivPassword == "" {
+			return nil, fmt.Errorf("snmp user %s: priv_password is required", cfg.Username)
+		}
+		level = gosnmp.AuthPriv
+	}
+
+	params := &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    engineID,
+		UserName:                 cfg.Username,
+		AuthenticationProtocol:   auth,
+		AuthenticationPassphrase: cfg.AuthPassword,
+		PrivacyProtocol:          priv,
+		PrivacyPassphrase:        cfg.PrivPassword,
+	}
+	err := params.InitSecurityKeys()
+	if err != nil {
+		return nil, fmt.Errorf("snmp user %s: %w", cfg.Username, err)
+	}
+	return &user{params: params, level: level}, nil
+}
+
+// decodeV3 authenticates and decrypts a SNMPv3 request. It returns the report
+// to send back instead when the request is an engine discovery or is outside
+// the time window, and nil for both when the request must be dropped.
+func (s *Server) decodeV3(msg []byte) (*gosnmp.SnmpPacket, *gosnmp.SnmpPacket) {
+	packet, err := s.v3.UnmarshalTrap(clone(msg), true)
+	if err != nil {
+		// discovery requests come without user and security
+		packet, err = s.discovery.UnmarshalTrap(clone(msg), true)
+		if err != nil || packet.MsgFlags&gosnmp.AuthNoPriv > 0 {
+			s.log.Debugf("dropping snmpv3 request: %v", err)
+			return nil, nil
+		}
+	}
+	params, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return nil, nil
+	}
+
+	if params.AuthoritativeEngineID != s.engineID {
+		if packet.MsgFlags&gosnmp.Reportable == 0 {
+			return nil, nil
+		}
+		s.mu.Lock()
+		s.unknownEngineIDs++
+		count := s.unknownEngineIDs
+		s.mu.Unlock()
+		return nil, s.report(packet, gosnmp.NoAuthNoPriv, &gosnmp.UsmSecurityParameters{UserName: params.UserName}, usmStatsUnknownEngineIDs, count)
+	}
+
+	u, ok := s.users[params.UserName]
+	if !ok || packet.MsgFlags&gosnmp.AuthPriv < u.level {
+		s.log.Debugf("dropping snmpv3 request from user %q: unknown user or security level too low", params.UserName)
+		return nil, nil
+	}
+
+	if packet.MsgFlags&gosnmp.AuthNoPriv > 0 {
+		now := s.engineTime()
+		diff := int64(now) - int64(params.AuthoritativeEngineTime)
+		if params.AuthoritativeEngineBoots != s.boots || diff > timeWindow || diff < -timeWindow {
+			s.mu.Lock()
+			s.notInTimeWindows++
+			count := s.notInTimeWindows
+			s.mu.Unlock()
+			return nil, s.report(packet, gosnmp.AuthNoPriv, params, usmStatsNotInTimeWindows, count)
+		}
+	}
+	return packet, nil
+}
+
+// report builds a Report PDU with the increased usmStats counter.
+func (s *Server) report(request *gosnmp.SnmpPacket, flags gosnmp.SnmpV3MsgFlags, params *gosnmp.UsmSecurityParameters, oid string, count uint32) *gosnmp.SnmpPacket {
+	packet := s.responseV3(request, params, []gosnmp.SnmpPDU{
+		{Name: oid, Type: gosnmp.Counter32, Value: count},
+	})
+	packet.PDUType = gosnmp.Report
+	packet.MsgFlags = flags
+	return packet
+}
+
+// responseV3 builds the response to a request, secured with the request
+// security level and the agent engine boots and time.
+func (s *Server) responseV3(request *gosnmp.SnmpPacket, params *gosnmp.UsmSecurityParameters, vars []gosnmp.SnmpPDU) *gosnmp.SnmpPacket {
+	out := params.Copy().(*gosnmp.UsmSecurityParameters)
+	out.AuthoritativeEngineID = s.engineID
+	out.AuthoritativeEngineBoots = s.boots
+	out.AuthoritativeEngineTime = s.engineTime()
+	out.AuthenticationParameters = ""
+	out.PrivacyParameters = nil
+
+	return &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           request.MsgFlags &^ gosnmp.Reportable,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: out,
+		MsgID:              request.MsgID,
+		ContextEngineID:    s.engineID,
+		ContextName:        request.ContextName,
+		PDUType:            gosnmp.GetResponse,
+		RequestID:          request.RequestID,
+		Variables:          vars,
+	}
+}
+
+// secure sets the privacy salt of an encrypted response, allocated by the
+// user so it is never reused.
+func (s *Server) secure(packet *gosnmp.SnmpPacket) error {
+	if packet.MsgFlags&gosnmp.AuthPriv <= gosnmp.AuthNoPriv {
+		return nil
+	}
+	params, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return fmt.Errorf("unexpected security parameters %T", packet.SecurityParameters)
+	}
+	u, ok := s.users[params.UserName]
+	if !ok {
+		return fmt.Errorf("unknown user %s", params.UserName)
+	}
+	return u.params.InitPacket(packet)
+}
+
+func clone(msg []byte) []byte {
+	c := make([]byte, len(msg))
+	copy(c, msg)
+	return c
+}
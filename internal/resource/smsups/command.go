@@ -0,0 +1,137 @@
+package smsups
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"strconv"
+	"time"
+)
+
+// Command is an action run by the UPS. Names follow the NUT instant commands.
+type Command string
+
+const (
+	CommandTestStart      Command = "test.battery.start"
+	CommandTestStop       Command = "test.battery.stop"
+	CommandBeeperToggle   Command = "beeper.toggle"
+	CommandShutdown       Command = "shutdown.return"
+	CommandRestart        Command = "shutdown.reboot"
+	CommandShutdownCancel Command = "shutdown.stop"
+)
+
+// commands maps each command to the code of the SMS command endpoint.
+//
+// SMS does not publish the mobile API. /sms/mobile/comando/ and these codes
+// follow the naming of the other mobile endpoints and the "Comando inválido"
+// status of ErrorCodes, and were only checked against smsupstest, not against
+// a real UPS. Record a session with fixtures.record before relying on them;
+// the shutdown commands are refused until commands.experimental is set.
+var commands = map[Command]string{
+	CommandTestStart:      "testebateria",
+	CommandTestStop:       "cancelateste",
+	CommandBeeperToggle:   "beep",
+	CommandShutdown:       "shutdown",
+	CommandRestart:        "restore",
+	CommandShutdownCancel: "cancelashutdown",
+}
+
+// Commands returns the commands supported by the UPS, with the experimental
+// ones only when experimental is set.
+func Commands(experimental bool) []Command {
+	all := []Command{
+		CommandTestStart,
+		CommandTestStop,
+		CommandBeeperToggle,
+		CommandShutdown,
+		CommandRestart,
+		CommandShutdownCancel,
+	}
+	var commands []Command
+	for _, cmd := range all {
+		if experimental || !cmd.Experimental() {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// ParseCommand returns the command with the given name.
+func ParseCommand(name string) (Command, error) {
+	cmd := Command(name)
+	if _, ok := commands[cmd]; !ok {
+		return "", fmt.Errorf("unknown command %s", name)
+	}
+	return cmd, nil
+}
+
+// Experimental tells whether the command is only sent when the experimental
+// commands are enabled. The shutdown commands are, since a wrong guess of
+// their code or delay could power off the load.
+func (c Command) Experimental() bool {
+	return c == CommandShutdown || c == CommandRestart || c == CommandShutdownCancel
+}
+
+// Scheduled tells whether the command accepts a delay.
+func (c Command) Scheduled() bool {
+	return c == CommandShutdown || c == CommandRestart
+}
+
+// SendCommand asks the UPS to run the command. Shutdown and restart are run
+// after delay, rounded up to whole minutes as the UPS counts minutes, so a
+// delay never shortens; the other commands run at once.
+func (g *SMSUps) SendCommand(ctx context.Context, cmd Command, delay time.Duration) error {
+	code, ok := commands[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+	if cmd.Experimental() && !g.experimental {
+		return fmt.Errorf("command %s is experimental, set commands.experimental to send it", cmd)
+	}
+	if delay < 0 || (delay > 0 && !cmd.Scheduled()) {
+		return fmt.Errorf("command %s does not accept a delay of %s", cmd, delay)
+	}
+
+	minutes := int((delay + time.Minute - 1) / time.Minute)
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// commands like beeper.toggle are not idempotent, so they are never
+	// retried; only a rejected token is renewed before sending it again
+	err := g.authorized(reqCtx, "command", func(creds credentials) (string, error) {
+		response, err := g.command(reqCtx, creds, code, minutes)
+		return response.ResponseStatus, err
+	})
+	if err != nil {
+		return fmt.Errorf("command %s: %w", cmd, err)
+	}
+	return nil
+}
+
+func (g *SMSUps) command(ctx context.Context, creds credentials, code string, minutes int) (device.CommandResponse, error) {
+	var response device.CommandResponse
+
+	query := map[string]string{
+		"comando": code,
+	}
+	if minutes > 0 {
+		query["tempo"] = strconv.Itoa(minutes)
+	}
+	request := client.Request{
+		Url: "/sms/mobile/comando/",
+		Headers: map[string]string{
+			"token":    creds.token,
+			"deployid": creds.deployID,
+		},
+		QueryParameters: query,
+	}
+	get, err := g.client.Post(ctx, request, nil, &response)
+	err = checkResponse("command", get, err)
+	if err != nil {
+		return response, err
+	}
+	printRequest(g.log, get)
+	return response, nil
+}
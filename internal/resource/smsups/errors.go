@@ -0,0 +1,123 @@
+package smsups
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrUnauthorized matches the responses rejecting the session token. The
+	// token is renewed once before it is returned.
+	ErrUnauthorized = errors.New("session token rejected")
+	// ErrCredentials matches the responses rejecting the configured login.
+	ErrCredentials = errors.New("invalid username or password")
+)
+
+// TransportError is a request that did not get a response, like a timeout
+// or a refused connection. It is retried.
+type TransportError struct {
+	Op  string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError is a response with an HTTP error status. Server errors, timeouts
+// and rate limits are retried.
+type HTTPError struct {
+	Op         string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: http status %d: %s", e.Op, e.StatusCode, e.Body)
+}
+
+// StatusError is a response rejected by the SMS API with a status code, like
+// S003 for an invalid token. It is never retried.
+type StatusError struct {
+	Op   string
+	Code string
+}
+
+func (e *StatusError) Error() string {
+	message := client.ErrorCodes(e.Code)
+	if message == "" || message == e.Code {
+		return fmt.Sprintf("%s: status %s", e.Op, e.Code)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Op, message, e.Code)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return tokenRejected(e.Code)
+	case ErrCredentials:
+		return e.Code == "S002"
+	}
+	return false
+}
+
+// ProtocolError is a response that could not be read, like a body that is
+// not the expected JSON. It is never retried.
+type ProtocolError struct {
+	Op  string
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: invalid response: %s", e.Op, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// tokenRejected tells whether the status asks for a new session token.
+func tokenRejected(code string) bool {
+	return code == "S003" || code == "S016"
+}
+
+// checkResponse turns the outcome of a request into one of the typed errors.
+func checkResponse(op string, get *client.Response, err error) error {
+	if err != nil {
+		var urlError *url.Error
+		var netError net.Error
+		if errors.As(err, &urlError) || errors.As(err, &netError) {
+			return &TransportError{Op: op, Err: err}
+		}
+		return &ProtocolError{Op: op, Err: err}
+	}
+	if get.IsError() {
+		return &HTTPError{Op: op, StatusCode: get.StatusCode(), Body: get.String()}
+	}
+	return nil
+}
+
+// retryable tells whether the error is transient, so the request may succeed
+// when sent again.
+func retryable(err error) bool {
+	var transportError *TransportError
+	var httpError *HTTPError
+
+	switch {
+	case errors.As(err, &transportError):
+		return true
+	case errors.As(err, &httpError):
+		return httpError.StatusCode >= http.StatusInternalServerError ||
+			httpError.StatusCode == http.StatusRequestTimeout ||
+			httpError.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
@@ -2,202 +2,197 @@ package smsups
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/alexwbaule/ups-metrics/internal/application"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
-	"net/url"
 	"time"
 )
 
 type SMSUps struct {
-	log      *logger.Logger
-	intv     time.Duration
-	client   *client.Client
-	loginusr device.Login
-	auth     *device.Authentication
-	maxTry   int
+	log     *logger.Logger
+	name    string
+	intv    time.Duration
+	client  *client.Client
+	session *session
+	retry   retryPolicy
+	// experimental enables the experimental commands
+	experimental bool
 }
 
-func MewSMSUPS(l *application.Application) *SMSUps {
-	return &SMSUps{
-		log:      l.Log,
-		intv:     l.Config.GetInterval(),
-		client:   client.New(l.Config, fmt.Sprintf("https://%s", l.Config.GetDeviceAddress()), l.Log),
-		loginusr: l.Config.GetLogin(),
-		maxTry:   l.Config.GetHttpClient().RetryCount,
+// MewSMSUPS returns the client of a UPS. With fixtures set, its traffic is
+// recorded to or replayed from the fixture directory.
+func MewSMSUPS(l *application.Application, d device.Device) (*SMSUps, error) {
+	log := l.Log.With("device", d.Name)
+
+	// requests are retried by the retry policy, which knows which errors are
+	// worth sending again
+	httpClient := d.HttpClient
+	httpClient.RetryCount = 0
+	c := client.NewInsecure(httpClient, fmt.Sprintf("https://%s", d.Address), log)
+
+	switch {
+	case d.Fixtures.Record != "":
+		log.Warnf("recording requests to %s", d.Fixtures.Record)
+		err := c.Record(d.Fixtures.Record)
+		if err != nil {
+			return nil, err
+		}
+	case d.Fixtures.Replay != "":
+		log.Warnf("replaying requests from %s, the UPS is not used", d.Fixtures.Replay)
+		err := c.Replay(d.Fixtures.Replay)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	return &SMSUps{
+		log:     log,
+		name:    d.Name,
+		intv:    d.Interval,
+		client:  c,
+		session: newSession(log, c, d.Login),
+		retry:   newRetryPolicy(d.HttpClient),
+
+		experimental: l.Config.GetCommandsConfig().Experimental,
+	}, nil
 }
 
-func (g *SMSUps) GetMeasurements(ctx context.Context) (device.Metric, error) {
+func (g *SMSUps) Name() string {
+	return g.name
+}
+
+func (g *SMSUps) Interval() time.Duration {
+	return g.intv
+}
+
+// GetMeasurements reads the UPS, returning the normalized reading.
+func (g *SMSUps) GetMeasurements(ctx context.Context) (device.Reading, error) {
 	// Adiciona timeout de 30s para a requisição completa
 	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	return g.medidores(reqCtx, 1)
+	metrics, err := g.medidores(reqCtx)
+	if err != nil {
+		return device.Reading{}, err
+	}
+	metrics.Device = g.name
+	return normalize(metrics), nil
 }
 
 func (g *SMSUps) GetNotifications(ctx context.Context) (device.Notifications, error) {
 	// Adiciona timeout de 30s para a requisição completa
 	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	return g.notifications(reqCtx, 1)
+	notifications, err := g.notifications(reqCtx)
+	for i := range notifications.Notifications {
+		notifications.Notifications[i].Device = g.name
+	}
+	return notifications, err
 }
 
-func (g *SMSUps) Login(ctx context.Context, retryCount int) error {
-	g.log.Infof("Calling Login....[%d]", retryCount)
-	request := client.Request{
-		Url:            "/sms/mobile/login/",
-		PathParameters: nil,
-		Headers:        nil,
-		QueryParameters: map[string]string{
-			"username": g.loginusr.Username,
-			"password": g.loginusr.Password,
-			"iddevice": "22",
-			"sodevice": "android",
-		},
-	}
-	get, err := g.client.Post(ctx, request, nil, &g.auth)
-	g.print(get)
-	if err != nil {
-		return g.backoffLogin(ctx, retryCount, err)
-	}
-	if get.IsError() {
-		return g.backoffLogin(ctx, retryCount, get.Error().(error))
-	}
-	if g.auth.ResponseStatus != "S001" {
-		return fmt.Errorf("login error: %s", client.ErrorCodes(g.auth.ResponseStatus))
-	}
-	return nil
+// Login starts a new session. Later requests log in again when the token
+// expires or is rejected.
+func (g *SMSUps) Login(ctx context.Context) error {
+	g.log.Infof("Calling Login....")
+	return g.retry.do(ctx, g.log, g.session.Login)
 }
 
-func (g *SMSUps) notifications(ctx context.Context, retryCount int) (device.Notifications, error) {
+func (g *SMSUps) notifications(ctx context.Context) (device.Notifications, error) {
 	var notifications device.Notifications
 
-	request := client.Request{
-		Url:            "/sms/mobile/beannotificacao/",
-		PathParameters: nil,
-		Headers: map[string]string{
-			"token":    g.auth.Token,
-			"deployid": g.auth.DeployID,
-		},
-		QueryParameters: map[string]string{
-			"qtd": "1000",
-		},
-	}
-	get, err := g.client.Get(ctx, request, &notifications)
-	g.print(get)
+	err := g.retry.do(ctx, g.log, func(ctx context.Context) error {
+		return g.authorized(ctx, "notifications", func(creds credentials) (string, error) {
+			notifications = device.Notifications{}
+			request := client.Request{
+				Url:            "/sms/mobile/beannotificacao/",
+				PathParameters: nil,
+				Headers: map[string]string{
+					"token":    creds.token,
+					"deployid": creds.deployID,
+				},
+				QueryParameters: map[string]string{
+					"qtd": "1000",
+				},
+			}
+			get, err := g.client.Get(ctx, request, &notifications)
+			err = checkResponse("notifications", get, err)
+			if err != nil {
+				return "", err
+			}
+			printRequest(g.log, get)
+			if notifications.ResponseStatus == "" {
+				// the list is sent without status when it succeeds
+				return "S001", nil
+			}
+			return notifications.ResponseStatus, nil
+		})
+	})
 	if err != nil {
-		return g.backoffNotification(ctx, retryCount, err)
-	}
-	if get.IsError() {
-		return g.backoffNotification(ctx, retryCount, get.Error().(error))
-	}
-	if notifications.ResponseStatus != "" {
-		g.log.Errorf("token error: [%s]", client.ErrorCodes(notifications.ResponseStatus))
-		g.log.Errorf("metrics error: [%#v]", notifications)
-
-		err := g.Login(ctx, 1)
-		if err != nil {
-			return g.notifications(ctx, retryCount)
-		}
+		return device.Notifications{}, err
 	}
 	return notifications, nil
 }
 
-func (g *SMSUps) medidores(ctx context.Context, retryCount int) (device.Metric, error) {
+func (g *SMSUps) medidores(ctx context.Context) (device.Metric, error) {
 	var metrics device.Metric
 
-	request := client.Request{
-		Url:            "/sms/mobile/medidores/",
-		PathParameters: nil,
-		Headers: map[string]string{
-			"token":    g.auth.Token,
-			"deployid": g.auth.DeployID,
-		},
-		QueryParameters: nil,
-	}
-	get, err := g.client.Get(ctx, request, &metrics)
-	g.print(get)
-
+	err := g.retry.do(ctx, g.log, func(ctx context.Context) error {
+		return g.authorized(ctx, "metrics", func(creds credentials) (string, error) {
+			metrics = device.Metric{}
+			request := client.Request{
+				Url:            "/sms/mobile/medidores/",
+				PathParameters: nil,
+				Headers: map[string]string{
+					"token":    creds.token,
+					"deployid": creds.deployID,
+				},
+				QueryParameters: nil,
+			}
+			get, err := g.client.Get(ctx, request, &metrics)
+			err = checkResponse("metrics", get, err)
+			if err != nil {
+				return "", err
+			}
+			printRequest(g.log, get)
+			return metrics.ResponseStatus, nil
+		})
+	})
 	if err != nil {
-		return g.backoffMetric(ctx, retryCount, err)
-	}
-	if get.IsError() {
-		return g.backoffMetric(ctx, retryCount, get.Error().(error))
-	}
-	if metrics.ResponseStatus != "S001" {
-		g.log.Errorf("token error: [%s]", client.ErrorCodes(metrics.ResponseStatus))
-		g.log.Errorf("metrics error: [%#v]", metrics)
-
-		err := g.Login(ctx, 1)
-		if err != nil {
-			return g.medidores(ctx, retryCount)
-		}
+		return device.Metric{}, err
 	}
 	metrics.GetAt = time.Now()
 	return metrics, nil
 }
 
-func (g *SMSUps) backoffNotification(ctx context.Context, retryCount int, err error) (device.Notifications, error) {
-	var urlError *url.Error
-
-	// Apenas 1 retry rápido - o ticker cuidará do resto
-	maxQuickRetries := 2
-	if retryCount >= maxQuickRetries {
-		return device.Notifications{}, fmt.Errorf("notification request failed after %d attempts: %w", retryCount, err)
-	}
-	
-	if errors.As(err, &urlError) {
-		if urlError.Timeout() {
-			g.log.Warnf("Notification timeout, quick retry %d/%d", retryCount, maxQuickRetries)
-			time.Sleep(2 * time.Second) // Espera 2s antes do retry
-			return g.notifications(ctx, retryCount+1)
+// authorized sends a request with the session token, renewing the token and
+// sending it once more when the UPS rejects it. send returns the status of
+// the response, and any status but S001 is returned as a StatusError.
+func (g *SMSUps) authorized(ctx context.Context, op string, send func(creds credentials) (string, error)) error {
+	for renewed := false; ; renewed = true {
+		creds, err := g.session.Credentials(ctx)
+		if err != nil {
+			return err
 		}
-	}
-	return device.Notifications{}, fmt.Errorf("notification request failed: %w", err)
-}
-
-func (g *SMSUps) backoffMetric(ctx context.Context, retryCount int, err error) (device.Metric, error) {
-	var urlError *url.Error
-
-	// Apenas 1 retry rápido - o ticker cuidará do resto
-	maxQuickRetries := 2
-	if retryCount >= maxQuickRetries {
-		return device.Metric{}, fmt.Errorf("metric request failed after %d attempts: %w", retryCount, err)
-	}
-	
-	if errors.As(err, &urlError) {
-		if urlError.Timeout() {
-			g.log.Warnf("Metric timeout, quick retry %d/%d", retryCount, maxQuickRetries)
-			time.Sleep(2 * time.Second) // Espera 2s antes do retry
-			return g.medidores(ctx, retryCount+1)
+		status, err := send(creds)
+		if err != nil {
+			return err
 		}
-	}
-	return device.Metric{}, fmt.Errorf("metric request failed: %w", err)
-}
-
-func (g *SMSUps) backoffLogin(ctx context.Context, retryCount int, err error) error {
-	var urlError *url.Error
-
-	// Apenas 1 retry rápido - o ticker cuidará do resto
-	maxQuickRetries := 2
-	if retryCount >= maxQuickRetries {
-		return fmt.Errorf("login failed after %d attempts: %w", retryCount, err)
-	}
-	
-	if errors.As(err, &urlError) {
-		if urlError.Timeout() {
-			g.log.Warnf("Login timeout, quick retry %d/%d", retryCount, maxQuickRetries)
-			time.Sleep(2 * time.Second) // Espera 2s antes do retry
-			return g.Login(ctx, retryCount+1)
+		if status == "S001" {
+			return nil
+		}
+		if renewed || !tokenRejected(status) {
+			return &StatusError{Op: op, Code: status}
+		}
+		g.log.Warnf("token rejected: [%s], renewing session", client.ErrorCodes(status))
+		err = g.session.Invalidate(ctx, creds)
+		if err != nil {
+			return err
 		}
 	}
-	return fmt.Errorf("login failed: %w", err)
 }
 
-func (g *SMSUps) print(get *client.Response) {
+func printRequest(log *logger.Logger, get *client.Response) {
 	debug := fmt.Sprintf("curl -X %s \"%s\" ", get.Request.Method, get.Request.URL)
 	for s, header := range get.Request.Header {
 		if s == "User-Agent" {
@@ -205,5 +200,5 @@ func (g *SMSUps) print(get *client.Response) {
 		}
 		debug += fmt.Sprintf("--header \"%s: %s\" ", s, header[0])
 	}
-	g.log.Debug(debug)
+	log.Debug(debug)
 }
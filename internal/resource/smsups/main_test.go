@@ -0,0 +1,152 @@
+package smsups_test
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestUPS(t *testing.T) (*smsupstest.Server, *smsups.SMSUps) {
+	t.Helper()
+	return newTestUPSConfig(t, "")
+}
+
+func newTestUPSConfig(t *testing.T, extra string) (*smsupstest.Server, *smsups.SMSUps) {
+	t.Helper()
+	fake, app := smsupstest.NewApplication(t, extra)
+	sms, err := smsups.MewSMSUPS(app, app.Config.GetDevices()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, sms
+}
+
+func TestGetMeasurements(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPS(t)
+
+	reading, err := sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reading.Device != "rack" {
+		t.Errorf("device %q, want rack", reading.Device)
+	}
+	if m := reading.Measurements[device.QuantityInputVoltage]; m.Value != 127 {
+		t.Errorf("input voltage %v, want 127", m.Value)
+	}
+	if !reading.Statuses[device.StatusOnGrid] {
+		t.Errorf("reading is not on grid")
+	}
+
+	fake.PowerLoss()
+	reading, err = sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, ok := reading.Statuses[device.StatusOnGrid]; !ok || on {
+		t.Errorf("on grid %v (reported %v), want false", on, ok)
+	}
+}
+
+func TestExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPS(t)
+
+	_, err := sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.ExpireTokens()
+	_, err = sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatalf("the token was not renewed: %s", err)
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPS(t)
+
+	err := sms.Login(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.SetMalformed(true)
+	_, err = sms.GetMeasurements(ctx)
+	if err == nil {
+		t.Fatal("expected an error for a malformed response")
+	}
+	fake.SetMalformed(false)
+	_, err = sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetNotifications(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPS(t)
+
+	fake.PowerLoss()
+	fake.PowerRestore()
+	n, err := sms.GetNotifications(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, notification := range n.Notifications {
+		messages = append(messages, notification.Message)
+	}
+	// newest first, like the device
+	want := []string{smsupstest.MessagePowerRestored, smsupstest.MessagePowerFailure}
+	if !slices.Equal(messages, want) {
+		t.Fatalf("notifications %v, want %v", messages, want)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPSConfig(t, "commands:\n  experimental: true\n")
+
+	err := sms.SendCommand(ctx, smsups.CommandTestStart, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sms.SendCommand(ctx, smsups.CommandShutdown, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sms.SendCommand(ctx, smsups.CommandTestStop, time.Minute)
+	if err == nil {
+		t.Fatal("expected an error for a delayed battery test stop")
+	}
+	if got, want := fake.Commands(), []string{"testebateria", "shutdown"}; !slices.Equal(got, want) {
+		t.Fatalf("commands %v, want %v", got, want)
+	}
+	if !fake.State().Testing {
+		t.Errorf("the battery test did not start")
+	}
+}
+
+func TestExperimentalCommands(t *testing.T) {
+	ctx := context.Background()
+	fake, sms := newTestUPS(t)
+
+	for _, cmd := range []smsups.Command{smsups.CommandShutdown, smsups.CommandRestart, smsups.CommandShutdownCancel} {
+		if slices.Contains(smsups.Commands(false), cmd) {
+			t.Errorf("%s listed without experimental commands", cmd)
+		}
+		err := sms.SendCommand(ctx, cmd, 0)
+		if err == nil {
+			t.Errorf("%s sent without experimental commands", cmd)
+		}
+	}
+	if got := fake.Commands(); len(got) > 0 {
+		t.Fatalf("the UPS got %v", got)
+	}
+}
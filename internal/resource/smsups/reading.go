@@ -0,0 +1,93 @@
+package smsups
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// quantities maps the gauge names sent by the UPS to the quantities.
+var quantities = map[string]device.Quantity{
+	"Tensao de Entrada":   device.QuantityInputVoltage,
+	"Tensao de Saida":     device.QuantityOutputVoltage,
+	"Nivel da Bateria":    device.QuantityBatteryLevel,
+	"Potencia de Saida":   device.QuantityLoad,
+	"Temperatura":         device.QuantityTemperature,
+	"Frequencia de Saida": device.QuantityOutputFrequency,
+}
+
+// statuses maps the state names sent by the UPS to the statuses.
+var statuses = map[string]device.Status{
+	"Nobreak":          device.StatusBatteryFail,
+	"Carga da Bateria": device.StatusBatteryFull,
+	"Rede Eletrica":    device.StatusOnGrid,
+	"Teste":            device.StatusTest,
+	"Alerta 24h":       device.StatusAlert24h,
+	"Boost":            device.StatusBoost,
+	"ByPass":           device.StatusBypass,
+	"Potencia Elevada": device.StatusHighPower,
+	"UPS_Wifi":         device.StatusWifi,
+	"LED_RGB":          device.StatusRGB,
+}
+
+// typeGauge is the gauge holding the kind of UPS, as text.
+const typeGauge = "Tipo"
+
+// normalize turns the raw metric of the UPS into a Reading. Gauges and states
+// with unknown names or values that are not numbers are left out.
+func normalize(metric device.Metric) device.Reading {
+	reading := device.Reading{
+		Device:       metric.Device,
+		DeployID:     metric.DeployID,
+		DeployName:   metric.DeployName,
+		UPSType:      metric.UPSType,
+		GetAt:        metric.GetAt,
+		Measurements: make(map[device.Quantity]device.Measurement, len(metric.Gauges)),
+		Statuses:     make(map[device.Status]bool, len(metric.States)+1),
+	}
+
+	for _, gauge := range metric.Gauges {
+		if gauge.Name == typeGauge {
+			reading.Statuses[device.StatusInteractive] = gauge.Phases.Value == "UPS Line Interative"
+			continue
+		}
+		q, ok := quantities[gauge.Name]
+		if !ok {
+			continue
+		}
+		value, ok := parseFloat(gauge.Phases.Value)
+		if !ok {
+			continue
+		}
+		m := device.Measurement{Value: value, Min: value, Max: value, Unit: q.Unit()}
+		lowest, minOk := parseFloat(gauge.Phases.Min)
+		highest, maxOk := parseFloat(gauge.Phases.Max)
+		if minOk && maxOk {
+			m.Min, m.Max = min(lowest, value), max(highest, value)
+			m.HasRange = true
+		}
+		reading.Measurements[q] = m
+	}
+
+	for _, state := range metric.States {
+		if s, ok := statuses[state.Name]; ok {
+			reading.Statuses[s] = state.Value
+		}
+	}
+	return reading
+}
+
+// parseFloat parses a raw UPS reading, accepting "," as decimal separator.
+// NaN and infinite values are rejected.
+func parseFloat(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,93 @@
+package smsups_test
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/domain/service/metric"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups"
+	"github.com/alexwbaule/ups-metrics/internal/resource/smsups/smsupstest"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer/latest"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata/fixtures are synthetic: they were recorded with
+// fixtures.record from the fake UPS of smsupstest (deployId "fake"), not from
+// a real UPS, so they test the recording and replay and the parsing of the
+// responses as the fake shapes them. They hold a login, a reading on grid, a
+// reading after a power loss and the notifications. Tokens and passwords are
+// redacted as in any recording, so a recording of a real UPS can take their
+// place once one is available.
+const fixtures = "testdata/fixtures"
+
+func newReplayUPS(t *testing.T) (*smsups.SMSUps, *latest.Store, func(ctx context.Context) error) {
+	t.Helper()
+	_, app := smsupstest.NewApplication(t, "")
+	d := app.Config.GetDevices()[0]
+	d.Fixtures.Replay = fixtures
+	sms, err := smsups.MewSMSUPS(app, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := latest.NewStore()
+	return sms, store, metric.NewMetric(app, sms, store).Run
+}
+
+func TestReplayFixtures(t *testing.T) {
+	ctx := context.Background()
+	sms, _, _ := newReplayUPS(t)
+
+	reading, err := sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reading.Statuses[device.StatusOnGrid] {
+		t.Errorf("first reading is not on grid")
+	}
+	if m := reading.Measurements[device.QuantityBatteryLevel]; m.Value != 100 {
+		t.Errorf("battery level %v, want 100", m.Value)
+	}
+
+	reading, err = sms.GetMeasurements(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, ok := reading.Statuses[device.StatusOnGrid]; !ok || on {
+		t.Errorf("on grid %v (reported %v) after the power loss, want false", on, ok)
+	}
+	input := reading.Measurements[device.QuantityInputVoltage]
+	if input.Value != 0 || !input.HasRange || input.Min != 0 || input.Max != 127 {
+		t.Errorf("input voltage %+v, want 0 between 0 and 127", input)
+	}
+
+	n, err := sms.GetNotifications(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Notifications) != 1 || n.Notifications[0].Message != smsupstest.MessagePowerFailure {
+		t.Fatalf("notifications %+v, want the power failure", n.Notifications)
+	}
+}
+
+func TestReplayCollector(t *testing.T) {
+	_, store, run := newReplayUPS(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go run(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reading, ok := store.Get("rack")
+		if on, reported := reading.Statuses[device.StatusOnGrid]; ok && reported && !on {
+			if reading.DeployName != "rack" {
+				t.Errorf("deploy name %q, want rack", reading.DeployName)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the collector, last reading %+v", reading)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,69 @@
+package smsups
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"math/rand"
+	"time"
+)
+
+// retryPolicy sends a request again while it fails for transient reasons,
+// waiting an exponential backoff with jitter between attempts.
+type retryPolicy struct {
+	attempts int
+	wait     time.Duration
+	maxWait  time.Duration
+}
+
+// newRetryPolicy makes retry_count retries, starting at retry_wait_count and
+// doubling up to retry_max_wait_time.
+func newRetryPolicy(cfg device.HttpClient) retryPolicy {
+	return retryPolicy{
+		attempts: cfg.RetryCount + 1,
+		wait:     cfg.RetryWaitCount,
+		maxWait:  cfg.RetryMaxWaitTime,
+	}
+}
+
+// do calls fn until it succeeds, fails with an error that is not retryable,
+// runs out of attempts or ctx is done.
+func (p retryPolicy) do(ctx context.Context, log *logger.Logger, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= p.attempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+		wait := p.backoff(attempt)
+		log.Warnf("%s, retry %d/%d in %s", err, attempt, p.attempts-1, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (retry cancelled: %w)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles the wait on every attempt up to maxWait, and picks a random
+// duration between half and all of it so devices do not retry in lockstep.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	wait := p.wait
+	for i := 1; i < attempt && wait < p.maxWait; i++ {
+		wait *= 2
+	}
+	if p.maxWait > 0 && wait > p.maxWait {
+		wait = p.maxWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
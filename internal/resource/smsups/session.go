@@ -0,0 +1,148 @@
+package smsups
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryMargin logs in again a bit before the token expires, so requests in
+// flight do not race the expiry.
+const expiryMargin = time.Minute
+
+// session keeps the token shared by the metric, notification and command
+// jobs of a device. Logins are serialized: the first job that sees a
+// rejected token logs in again, and the others reuse the new token.
+type session struct {
+	log    *logger.Logger
+	client *client.Client
+	login  device.Login
+
+	mu         sync.Mutex
+	auth       *device.Authentication
+	expires    time.Time
+	generation uint64
+}
+
+// credentials is the token used by a request, and the session generation it
+// came from.
+type credentials struct {
+	token      string
+	deployID   string
+	generation uint64
+}
+
+func newSession(l *logger.Logger, c *client.Client, login device.Login) *session {
+	return &session{
+		log:    l,
+		client: c,
+		login:  login,
+	}
+}
+
+// Credentials returns a valid token, logging in again first when it is about
+// to expire.
+func (s *session) Credentials(ctx context.Context) (credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auth == nil {
+		err := s.fullLogin(ctx)
+		if err != nil {
+			return credentials{}, err
+		}
+	} else if time.Now().After(s.expires.Add(-expiryMargin)) {
+		err := s.fullLogin(ctx)
+		if err != nil {
+			return credentials{}, err
+		}
+	}
+	return s.credentials(), nil
+}
+
+// Invalidate logs in again when the UPS rejected the token. Nothing is done
+// when another job already logged in since the credentials were taken.
+func (s *session) Invalidate(ctx context.Context, rejected credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auth != nil && rejected.generation != s.generation {
+		return nil
+	}
+	return s.fullLogin(ctx)
+}
+
+// Login replaces the session with a new login.
+func (s *session) Login(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fullLogin(ctx)
+}
+
+func (s *session) credentials() credentials {
+	return credentials{
+		token:      s.auth.Token,
+		deployID:   s.auth.DeployID,
+		generation: s.generation,
+	}
+}
+
+func (s *session) fullLogin(ctx context.Context) error {
+	var auth device.Authentication
+
+	request := client.Request{
+		Url: "/sms/mobile/login/",
+		QueryParameters: map[string]string{
+			"username": s.login.Username,
+			"password": s.login.Password,
+			"iddevice": "22",
+			"sodevice": "android",
+		},
+	}
+	get, err := s.client.Post(ctx, request, nil, &auth)
+	err = checkResponse("login", get, err)
+	if err != nil {
+		return err
+	}
+	printRequest(s.log, get)
+	if auth.ResponseStatus != "S001" {
+		return &StatusError{Op: "login", Code: auth.ResponseStatus}
+	}
+	s.set(&auth)
+	s.log.Infof("logged in, token valid until %s", s.expires.Format(time.RFC3339))
+	return nil
+}
+
+func (s *session) set(auth *device.Authentication) {
+	s.auth = auth
+	s.generation++
+	s.expires = time.Now().Add(s.login.TokenTTL)
+	if exp, ok := tokenExpiry(auth.Token); ok {
+		s.expires = exp
+	}
+}
+
+// tokenExpiry reads the expiry claim of JWT tokens.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
@@ -0,0 +1,60 @@
+package smsupstest
+
+import (
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application"
+	"github.com/alexwbaule/ups-metrics/internal/application/config"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Login accepted by the fake UPS of NewApplication.
+const (
+	Username = "admin"
+	Password = "secret"
+)
+
+// NewApplication starts a fake UPS named "rack" and returns it with an
+// application polling it every 50ms, with short retry waits, keeping its
+// state in a temporary directory. extra is yaml added to the config, like a
+// metrics block. The fake is closed when the test ends.
+func NewApplication(t testing.TB, extra string) (*Server, *application.Application) {
+	t.Helper()
+	log := logger.NewLogger()
+
+	fake := NewServer(log, "rack", Username, Password)
+	err := fake.Start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fake.Close)
+
+	dir := t.TempDir()
+	yaml := fmt.Sprintf(`device:
+  name: rack
+  interval: 50ms
+  address: %s
+  login:
+    username: %s
+    password: %s
+  http:
+    client:
+      retry_wait_count: 10ms
+      retry_max_wait_time: 20ms
+state:
+  dir: %s
+%s`, fake.Addr(), Username, Password, dir, extra)
+
+	file := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(file, []byte(yaml), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, &application.Application{Log: log, Config: cfg}
+}
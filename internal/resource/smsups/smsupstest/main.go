@@ -0,0 +1,323 @@
+// Package smsupstest emulates the HTTPS API of an SMS UPS, so the collector,
+// writers and notifiers can run without a real device.
+package smsupstest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxNotifications is how many notifications the fake UPS keeps, newest
+// first like the device.
+const maxNotifications = 1000
+
+// Server is a fake SMS UPS. Its state, tokens and failures are changed by the
+// methods below, or by playing a Scenario.
+type Server struct {
+	log      *logger.Logger
+	name     string
+	username string
+	password string
+	server   *httptest.Server
+
+	mu            sync.Mutex
+	state         State
+	updated       time.Time
+	inputMin      float64
+	inputMax      float64
+	notifications []device.Notification
+	lastID        int
+	tokens        map[string]time.Time
+	tokenTTL      time.Duration
+	delay         time.Duration
+	malformed     bool
+	commands      []string
+}
+
+// NewServer returns a fake UPS accepting the given login, with DefaultState.
+// It is not listening until Start is called.
+func NewServer(l *logger.Logger, name, username, password string) *Server {
+	state := DefaultState()
+	return &Server{
+		log:      l.With("device", name),
+		name:     name,
+		username: username,
+		password: password,
+		state:    state,
+		updated:  time.Now(),
+		inputMin: state.input(),
+		inputMax: state.input(),
+		tokens:   make(map[string]time.Time),
+	}
+}
+
+// Start serves HTTPS on addr with a self signed certificate. An empty addr
+// listens on a random port of the loopback interface.
+func (s *Server) Start(addr string) error {
+	s.server = httptest.NewUnstartedServer(s)
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", addr, err)
+		}
+		s.server.Listener.Close()
+		s.server.Listener = listener
+	}
+	s.server.StartTLS()
+	s.log.Infof("fake ups listening on %s", s.Addr())
+	return nil
+}
+
+// Addr is the host:port to use as the device address.
+func (s *Server) Addr() string {
+	return s.server.Listener.Addr().String()
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// State returns the current state of the UPS.
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	return s.state
+}
+
+// Update changes the state of the UPS.
+func (s *Server) Update(f func(state *State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	f(&s.state)
+	s.track()
+}
+
+// PowerLoss switches the UPS to battery and notifies it.
+func (s *Server) PowerLoss() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	if s.state.OnGrid {
+		s.state.OnGrid = false
+		s.track()
+		s.notify(MessagePowerFailure)
+	}
+}
+
+// PowerRestore switches the UPS back to grid and notifies it.
+func (s *Server) PowerRestore() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	if !s.state.OnGrid {
+		s.state.OnGrid = true
+		s.track()
+		s.notify(MessagePowerRestored)
+	}
+}
+
+// Notify adds a notification with the given message.
+func (s *Server) Notify(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify(message)
+}
+
+// ExpireTokens rejects every token issued so far, as the device does after a
+// restart.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+}
+
+// SetTokenTTL makes new tokens expire after ttl. Zero never expires them.
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTTL = ttl
+}
+
+// SetDelay holds every response for delay.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// SetMalformed makes every response a body that is not valid JSON.
+func (s *Server) SetMalformed(malformed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.malformed = malformed
+}
+
+// Commands returns the codes received by the command endpoint, oldest first.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay, malformed := s.delay, s.malformed
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if malformed {
+		fmt.Fprint(w, `{"responseStatus": "S001", "medidores": [`)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	var response any
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/sms/mobile/login":
+		response = s.login(r)
+	case "/sms/mobile/medidores":
+		response = s.authorized(r, func() any {
+			metric := s.state.metric(s.name, s.inputMin, s.inputMax)
+			s.inputMin, s.inputMax = s.state.input(), s.state.input()
+			return metric
+		})
+	case "/sms/mobile/beannotificacao":
+		response = s.authorized(r, func() any {
+			return s.listNotifications(r)
+		})
+	case "/sms/mobile/comando":
+		response = s.authorized(r, func() any {
+			return s.command(r.URL.Query().Get("comando"))
+		})
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	s.log.Debugf("fake ups %s %s", r.Method, r.URL.Path)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		s.log.Errorf("error writing response: %s", err)
+	}
+}
+
+func (s *Server) login(r *http.Request) any {
+	query := r.URL.Query()
+	if query.Get("username") != s.username || query.Get("password") != s.password {
+		return device.Authentication{ResponseStatus: "S002"}
+	}
+	token := randomToken()
+	var expires time.Time
+	if s.tokenTTL > 0 {
+		expires = time.Now().Add(s.tokenTTL)
+	}
+	s.tokens[token] = expires
+	return device.Authentication{
+		ResponseStatus: "S001",
+		Token:          token,
+		RefreshToken:   randomToken(),
+		DeployID:       "fake",
+		DeployName:     s.name,
+		Usuario:        s.username,
+	}
+}
+
+// authorized answers S003 when the token is unknown or expired.
+func (s *Server) authorized(r *http.Request, f func() any) any {
+	expires, ok := s.tokens[r.Header.Get("token")]
+	if !ok || (!expires.IsZero() && time.Now().After(expires)) {
+		return device.CommandResponse{ResponseStatus: "S003"}
+	}
+	return f()
+}
+
+func (s *Server) listNotifications(r *http.Request) device.Notifications {
+	notifications := s.notifications
+	if qtd, err := strconv.Atoi(r.URL.Query().Get("qtd")); err == nil && qtd < len(notifications) {
+		notifications = notifications[:qtd]
+	}
+	return device.Notifications{
+		Notifications: append([]device.Notification{}, notifications...),
+	}
+}
+
+func (s *Server) command(code string) device.CommandResponse {
+	switch code {
+	case "testebateria":
+		s.state.Testing = true
+		s.notify(MessageTestStarted)
+	case "cancelateste":
+		if s.state.Testing {
+			s.state.Testing = false
+			s.notify(MessageTestFinished)
+		}
+	case "shutdown", "restore":
+		s.notify(MessageShutdown)
+	case "beep", "cancelashutdown":
+	default:
+		return device.CommandResponse{ResponseStatus: "S005"}
+	}
+	s.commands = append(s.commands, code)
+	return device.CommandResponse{ResponseStatus: "S001"}
+}
+
+// advance updates the battery level, notifying when it gets low. It must be
+// called with the lock held.
+func (s *Server) advance() {
+	now := time.Now()
+	if s.state.advance(now.Sub(s.updated)) {
+		s.notify(MessageBatteryLow)
+	}
+	s.updated = now
+}
+
+// track keeps the extremes of the input voltage between reads, so a power
+// loss shorter than the polling interval still shows in the min gauge. It
+// must be called with the lock held.
+func (s *Server) track() {
+	s.inputMin = min(s.inputMin, s.state.input())
+	s.inputMax = max(s.inputMax, s.state.input())
+}
+
+func (s *Server) notify(message string) {
+	s.lastID++
+	s.log.Infof("fake ups notification %d: %s", s.lastID, message)
+
+	n := device.Notification{
+		ID:      s.lastID,
+		Message: message,
+		Date:    time.Now().Format(dateLayout),
+	}
+	s.notifications = append([]device.Notification{n}, s.notifications...)
+	if len(s.notifications) > maxNotifications {
+		s.notifications = s.notifications[:maxNotifications]
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
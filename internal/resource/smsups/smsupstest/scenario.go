@@ -0,0 +1,104 @@
+package smsupstest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Step changes the fake UPS At a time after the scenario starts.
+type Step struct {
+	At time.Duration
+	Do func(s *Server)
+}
+
+// Scenario is a timeline of steps, played in order of At.
+type Scenario []Step
+
+// Scenarios are the scenarios selectable by name in the fake-ups subcommand.
+var Scenarios = map[string]Scenario{
+	// a healthy UPS that never changes
+	"normal": {},
+	// the power fails for a minute and a half and comes back
+	"power-loss": {
+		{At: 30 * time.Second, Do: (*Server).PowerLoss},
+		{At: 2 * time.Minute, Do: (*Server).PowerRestore},
+	},
+	// the power fails for good and the battery drains in about 5 minutes
+	"battery-drain": {
+		{At: 10 * time.Second, Do: func(s *Server) {
+			s.Update(func(state *State) {
+				state.DrainRate = 20
+			})
+			s.PowerLoss()
+		}},
+	},
+	// tokens last one minute, and every one is revoked after 3 minutes
+	"token-expiry": {
+		{At: 0, Do: func(s *Server) {
+			s.SetTokenTTL(time.Minute)
+		}},
+		{At: 3 * time.Minute, Do: (*Server).ExpireTokens},
+	},
+	// responses take 5 seconds for two minutes
+	"slow": {
+		{At: 0, Do: func(s *Server) {
+			s.SetDelay(5 * time.Second)
+		}},
+		{At: 2 * time.Minute, Do: func(s *Server) {
+			s.SetDelay(0)
+		}},
+	},
+	// responses are broken JSON for a minute
+	"malformed": {
+		{At: 30 * time.Second, Do: func(s *Server) {
+			s.SetMalformed(true)
+		}},
+		{At: 90 * time.Second, Do: func(s *Server) {
+			s.SetMalformed(false)
+		}},
+	},
+}
+
+// ScenarioNames returns the names of Scenarios, sorted.
+func ScenarioNames() []string {
+	var names []string
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Play runs the steps of the scenario at their time, returning when the last
+// one ran or ctx is done.
+func (s *Server) Play(ctx context.Context, scenario Scenario) error {
+	steps := append(Scenario(nil), scenario...)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].At < steps[j].At
+	})
+
+	start := time.Now()
+	for i, step := range steps {
+		timer := time.NewTimer(time.Until(start.Add(step.At)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		s.log.Infof("fake ups scenario step %d/%d", i+1, len(steps))
+		step.Do(s)
+	}
+	return nil
+}
+
+// PlayNamed runs one of Scenarios.
+func (s *Server) PlayNamed(ctx context.Context, name string) error {
+	scenario, ok := Scenarios[name]
+	if !ok {
+		return fmt.Errorf("unknown scenario %s", name)
+	}
+	return s.Play(ctx, scenario)
+}
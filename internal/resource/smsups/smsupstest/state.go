@@ -0,0 +1,130 @@
+package smsupstest
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "02/01/2006 15:04:05"
+
+// Messages sent by the fake UPS, worded like the firmware ones so they are
+// classified the same way.
+const (
+	MessagePowerFailure  = "Falha na rede elétrica"
+	MessagePowerRestored = "Retorno da rede elétrica"
+	MessageBatteryLow    = "Bateria baixa"
+	MessageTestStarted   = "Teste de bateria iniciado"
+	MessageTestFinished  = "Teste de bateria finalizado"
+	MessageShutdown      = "Desligamento programado do nobreak"
+)
+
+// State is what the fake UPS reports. The battery charges while on grid and
+// drains while on battery, at the given rates in percent per minute.
+type State struct {
+	Interactive   bool
+	OnGrid        bool
+	Testing       bool
+	Boost         bool
+	Bypass        bool
+	BatteryFail   bool
+	InputVoltage  float64
+	OutputVoltage float64
+	BatteryLevel  float64
+	Load          float64
+	Temperature   float64
+	Frequency     float64
+	LowBattery    float64
+	DrainRate     float64
+	ChargeRate    float64
+}
+
+// DefaultState is a line interactive UPS on grid with a full battery.
+func DefaultState() State {
+	return State{
+		Interactive:   true,
+		OnGrid:        true,
+		InputVoltage:  127,
+		OutputVoltage: 120,
+		BatteryLevel:  100,
+		Load:          25,
+		Temperature:   32,
+		Frequency:     60,
+		LowBattery:    20,
+		DrainRate:     5,
+		ChargeRate:    2,
+	}
+}
+
+// advance moves the battery level by the time passed since the last call.
+// It tells whether the level crossed LowBattery while draining.
+func (s *State) advance(elapsed time.Duration) (low bool) {
+	minutes := elapsed.Minutes()
+	before := s.BatteryLevel
+
+	if s.OnGrid && !s.Testing {
+		s.BatteryLevel = min(100, s.BatteryLevel+s.ChargeRate*minutes)
+		return false
+	}
+	s.BatteryLevel = max(0, s.BatteryLevel-s.DrainRate*minutes)
+	return before > s.LowBattery && s.BatteryLevel <= s.LowBattery
+}
+
+// input is the input voltage the UPS sees.
+func (s *State) input() float64 {
+	if !s.OnGrid {
+		return 0
+	}
+	return s.InputVoltage
+}
+
+// metric builds the response of /sms/mobile/medidores/, with the extremes of
+// the input voltage since the previous one.
+func (s *State) metric(name string, inputMin, inputMax float64) device.Metric {
+	kind := "UPS Standby"
+	if s.Interactive {
+		kind = "UPS Line Interative"
+	}
+	input := gauge("Tensao de Entrada", s.input(), "V")
+	input.Phases.Min = strconv.FormatFloat(inputMin, 'f', 1, 64)
+	input.Phases.Max = strconv.FormatFloat(inputMax, 'f', 1, 64)
+
+	return device.Metric{
+		ResponseStatus: "S001",
+		UPSType:        kind,
+		DeployID:       "fake",
+		DeployName:     name,
+		Alert24HState:  "false",
+		Gauges: []device.Gauges{
+			input,
+			gauge("Tensao de Saida", s.OutputVoltage, "V"),
+			gauge("Nivel da Bateria", s.BatteryLevel, "%"),
+			gauge("Potencia de Saida", s.Load, "%"),
+			gauge("Temperatura", s.Temperature, "°C"),
+			gauge("Frequencia de Saida", s.Frequency, "Hz"),
+			{Name: "Tipo", Phases: device.Phases{Value: kind}},
+		},
+		States: []device.States{
+			{Name: "Nobreak", Value: s.BatteryFail},
+			{Name: "Carga da Bateria", Value: s.BatteryLevel >= 100},
+			{Name: "Rede Eletrica", Value: s.OnGrid},
+			{Name: "Teste", Value: s.Testing},
+			{Name: "Alerta 24h", Value: false},
+			{Name: "Boost", Value: s.Boost},
+			{Name: "ByPass", Value: s.Bypass},
+			{Name: "Potencia Elevada", Value: s.Load > 90},
+			{Name: "UPS_Wifi", Value: true},
+			{Name: "LED_RGB", Value: false},
+		},
+	}
+}
+
+func gauge(name string, value float64, unit string) device.Gauges {
+	v := strconv.FormatFloat(value, 'f', 1, 64)
+	return device.Gauges{
+		Name:   name,
+		Type:   "medidor",
+		Unit:   unit,
+		Phases: device.Phases{Value: v, Max: v, Min: v},
+	}
+}
@@ -0,0 +1,240 @@
+package buffer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/application/utils"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayBatch limits how many buffered metrics are replayed on each write, so
+// a long outage doesn't hold the sink worker for too long.
+const replayBatch = 100
+
+// Buffer wraps a writer and keeps the metrics it failed to write in a
+// directory, one file per metric, named so that the lexical order is the
+// order they were collected. They are replayed in order once the writer
+// recovers, before any new metric.
+type Buffer struct {
+	log    *logger.Logger
+	name   string
+	writer writer.WriteMetric
+	dir    string
+	cfg    device.Buffer
+	mu     sync.Mutex
+	seq    uint64
+}
+
+type file struct {
+	path string
+	size int64
+	at   time.Time
+}
+
+func NewBuffer(l *logger.Logger, name string, w writer.WriteMetric, cfg device.Buffer) (writer.WriteMetric, error) {
+	b := &Buffer{
+		log:    l.With("sink", name),
+		name:   name,
+		writer: w,
+		dir:    filepath.Join(cfg.Path, name),
+		cfg:    cfg,
+	}
+	err := os.MkdirAll(b.dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating buffer directory: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	files, err := b.trim()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		b.log.Infof("%d buffered metrics waiting to be replayed", len(files))
+	}
+	return b, nil
+}
+
+func (b *Buffer) Write(ctx context.Context, reading device.Reading) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending, err := b.replay(ctx)
+	if err != nil {
+		return errors.Join(err, b.store(reading))
+	}
+	if pending {
+		return b.store(reading)
+	}
+
+	err = b.writer.Write(ctx, reading)
+	var rejected *writer.RejectedError
+	if errors.As(err, &rejected) {
+		return err
+	}
+	if err != nil {
+		return errors.Join(err, b.store(reading))
+	}
+	return nil
+}
+
+// replay writes the oldest buffered metrics, returning true when some are
+// still left to be replayed. Metrics the sink rejects are dropped, so they
+// never hold back the ones behind them.
+func (b *Buffer) replay(ctx context.Context) (bool, error) {
+	files, err := b.list()
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		return false, nil
+	}
+	b.log.Infof("replaying %d buffered metrics", min(len(files), replayBatch))
+
+	for i, f := range files {
+		if i == replayBatch {
+			return true, nil
+		}
+		reading, err := b.load(f.path)
+		if err != nil {
+			b.log.Errorf("discarding unreadable buffered metric %s: %s", f.path, err)
+			BufferDropped.WithLabelValues(b.name, "corrupt").Inc()
+			_ = os.Remove(f.path)
+			continue
+		}
+		err = b.writer.Write(ctx, reading)
+		var rejected *writer.RejectedError
+		if errors.As(err, &rejected) {
+			b.log.Errorf("dropping buffered metric %s rejected by the sink: %s", filepath.Base(f.path), err)
+			BufferDropped.WithLabelValues(b.name, "rejected").Inc()
+			_ = os.Remove(f.path)
+			continue
+		}
+		if err != nil {
+			b.setDepth(files[i:])
+			return true, fmt.Errorf("replaying buffered metric: %w", err)
+		}
+		_ = os.Remove(f.path)
+	}
+	b.setDepth(nil)
+	return false, nil
+}
+
+// store saves the reading in the buffer, atomically so a crash never leaves a
+// partial reading behind.
+func (b *Buffer) store(reading device.Reading) error {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		return err
+	}
+	b.seq++
+	name := fmt.Sprintf("%020d-%06d.json", reading.GetAt.UnixNano(), b.seq%1000000)
+
+	err = utils.WriteFileAtomic(filepath.Join(b.dir, name), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("error buffering metric: %w", err)
+	}
+	b.log.Infof("metric of %s collected at %s buffered", reading.Device, reading.GetAt.Format(time.RFC3339))
+
+	_, err = b.trim()
+	return err
+}
+
+func (b *Buffer) load(path string) (device.Reading, error) {
+	var reading device.Reading
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return device.Reading{}, err
+	}
+	err = json.Unmarshal(data, &reading)
+	if err != nil {
+		return device.Reading{}, err
+	}
+	if reading.Device == "" {
+		return device.Reading{}, fmt.Errorf("reading without device")
+	}
+	return reading, nil
+}
+
+// trim drops the metrics older than MaxAge and then the oldest ones until the
+// buffer fits in MaxSize, returning the files left.
+func (b *Buffer) trim() ([]file, error) {
+	files, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+
+	now := time.Now()
+	for len(files) > 0 {
+		f := files[0]
+		reason := ""
+		if b.cfg.MaxAge > 0 && now.Sub(f.at) > b.cfg.MaxAge {
+			reason = "age"
+		} else if b.cfg.MaxSize > 0 && size > b.cfg.MaxSize {
+			reason = "size"
+		} else {
+			break
+		}
+		b.log.Warnf("dropping buffered metric %s (%s limit)", filepath.Base(f.path), reason)
+		BufferDropped.WithLabelValues(b.name, reason).Inc()
+		_ = os.Remove(f.path)
+		size -= f.size
+		files = files[1:]
+	}
+	b.setDepth(files)
+	return files, nil
+}
+
+func (b *Buffer) list() ([]file, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading buffer directory: %w", err)
+	}
+	files := make([]file, 0, len(entries))
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		var nano int64
+		_, _ = fmt.Sscanf(e.Name(), "%d-", &nano)
+		files = append(files, file{
+			path: filepath.Join(b.dir, e.Name()),
+			size: info.Size(),
+			at:   time.Unix(0, nano),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
+
+func (b *Buffer) setDepth(files []file) {
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	BufferDepth.WithLabelValues(b.name).Set(float64(len(files)))
+	BufferBytes.WithLabelValues(b.name).Set(float64(size))
+}
@@ -0,0 +1,158 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sink fails every write with err, rejecting the readings of the devices in
+// reject, and keeps the ones it wrote.
+type sink struct {
+	err     error
+	reject  map[string]bool
+	written []string
+}
+
+func (s *sink) Write(_ context.Context, reading device.Reading) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.reject[reading.Device] {
+		return &writer.RejectedError{Err: errors.New("bad point")}
+	}
+	s.written = append(s.written, reading.Device)
+	return nil
+}
+
+func newTestBuffer(t *testing.T, s *sink) *Buffer {
+	t.Helper()
+	w, err := NewBuffer(logger.NewLogger(), "test", s, device.Buffer{Enabled: true, Path: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.(*Buffer)
+}
+
+func reading(name string, at time.Time) device.Reading {
+	return device.Reading{Device: name, GetAt: at}
+}
+
+func pending(t *testing.T, b *Buffer) int {
+	t.Helper()
+	files, err := b.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestBufferReplaysInOrder(t *testing.T) {
+	ctx := context.Background()
+	s := &sink{err: errors.New("connection refused")}
+	b := newTestBuffer(t, s)
+	now := time.Now()
+
+	for i, name := range []string{"a", "b"} {
+		if err := b.Write(ctx, reading(name, now.Add(time.Duration(i)*time.Second))); err == nil {
+			t.Fatal("expected the write to fail")
+		}
+	}
+	if got := pending(t, b); got != 2 {
+		t.Fatalf("buffered %d metrics, want 2", got)
+	}
+
+	s.err = nil
+	if err := b.Write(ctx, reading("c", now.Add(2*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if got := pending(t, b); got != 0 {
+		t.Fatalf("%d metrics left after the replay", got)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(s.written, want) {
+		t.Fatalf("written %v, want %v", s.written, want)
+	}
+}
+
+func TestBufferDropsRejected(t *testing.T) {
+	ctx := context.Background()
+	s := &sink{reject: map[string]bool{"bad": true}}
+	b := newTestBuffer(t, s)
+	now := time.Now()
+
+	var rejected *writer.RejectedError
+	err := b.Write(ctx, reading("bad", now))
+	if !errors.As(err, &rejected) {
+		t.Fatalf("got %v, want a rejected error", err)
+	}
+	if got := pending(t, b); got != 0 {
+		t.Fatalf("a rejected metric was buffered")
+	}
+
+	// a metric buffered during an outage and rejected on replay must not
+	// block the ones behind it
+	s.err = errors.New("connection refused")
+	_ = b.Write(ctx, reading("bad", now.Add(time.Second)))
+	_ = b.Write(ctx, reading("good", now.Add(2*time.Second)))
+	if got := pending(t, b); got != 2 {
+		t.Fatalf("buffered %d metrics, want 2", got)
+	}
+	s.err = nil
+
+	if err := b.Write(ctx, reading("next", now.Add(3*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if got := pending(t, b); got != 0 {
+		t.Fatalf("%d metrics left after the replay", got)
+	}
+	if want := []string{"good", "next"}; !slices.Equal(s.written, want) {
+		t.Fatalf("written %v, want %v", s.written, want)
+	}
+}
+
+func TestBufferKeepsReading(t *testing.T) {
+	b := newTestBuffer(t, &sink{})
+	want := device.Reading{
+		Device:   "rack",
+		DeployID: "1234",
+		GetAt:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Measurements: map[device.Quantity]device.Measurement{
+			device.QuantityBatteryLevel: {Value: 80},
+		},
+		Statuses: map[device.Status]bool{
+			device.StatusOnGrid: false,
+		},
+	}
+	err := b.store(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := b.list()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("buffered %d metrics (%v), want 1", len(files), err)
+	}
+	got, err := b.load(files[0].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Device != want.Device || got.DeployID != want.DeployID || !got.GetAt.Equal(want.GetAt) ||
+		got.Measurements[device.QuantityBatteryLevel] != want.Measurements[device.QuantityBatteryLevel] ||
+		len(got.Statuses) != 1 || got.Statuses[device.StatusOnGrid] {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+
+	err = os.WriteFile(files[0].path, []byte(`{}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.load(files[0].path)
+	if err == nil {
+		t.Error("loaded a reading without device")
+	}
+}
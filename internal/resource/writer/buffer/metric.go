@@ -0,0 +1,24 @@
+package buffer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var BufferDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "writer_buffer_depth",
+	Help:      "The number of metrics waiting to be replayed to a sink",
+}, []string{"sink"})
+
+var BufferBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "ups",
+	Name:      "writer_buffer_bytes",
+	Help:      "The disk space used by metrics waiting to be replayed to a sink",
+}, []string{"sink"})
+
+var BufferDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ups",
+	Name:      "writer_buffer_dropped_total",
+	Help:      "The number of buffered metrics dropped before being replayed",
+}, []string{"sink", "reason"})
@@ -0,0 +1,108 @@
+package influxdb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the protocol has no escape for line breaks in names, keys and tag values,
+// so they are dropped
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "", "\r", "")
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "", "\r", "")
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+type Tag struct {
+	Key   string
+	Value string
+}
+
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Point is a single line of the InfluxDB line protocol.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	Time        int64
+}
+
+// Encode appends the point to b, followed by a new line. Tags are sorted by key
+// and tags with an empty value are skipped, as the protocol does not allow them.
+func (p Point) Encode(b *strings.Builder) error {
+	if p.Measurement == "" {
+		return fmt.Errorf("point without measurement")
+	}
+	if len(p.Fields) == 0 {
+		return fmt.Errorf("point %s without fields", p.Measurement)
+	}
+
+	var line strings.Builder
+	line.WriteString(measurementEscaper.Replace(p.Measurement))
+
+	tags := make([]Tag, len(p.Tags))
+	copy(tags, p.Tags)
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+	for _, tag := range tags {
+		if tag.Key == "" || tag.Value == "" {
+			continue
+		}
+		line.WriteString(",")
+		line.WriteString(keyEscaper.Replace(tag.Key))
+		line.WriteString("=")
+		line.WriteString(keyEscaper.Replace(tag.Value))
+	}
+
+	for i, field := range p.Fields {
+		value, err := formatField(field.Value)
+		if err != nil {
+			return fmt.Errorf("point %s field %s: %w", p.Measurement, field.Key, err)
+		}
+		if i == 0 {
+			line.WriteString(" ")
+		} else {
+			line.WriteString(",")
+		}
+		line.WriteString(keyEscaper.Replace(field.Key))
+		line.WriteString("=")
+		line.WriteString(value)
+	}
+	line.WriteString(" ")
+	line.WriteString(strconv.FormatInt(p.Time, 10))
+	line.WriteString("\n")
+
+	b.WriteString(line.String())
+	return nil
+}
+
+func formatField(v any) (string, error) {
+	switch value := v.(type) {
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "", fmt.Errorf("invalid float %v", value)
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case float32:
+		return formatField(float64(value))
+	case int:
+		return strconv.FormatInt(int64(value), 10) + "i", nil
+	case int64:
+		return strconv.FormatInt(value, 10) + "i", nil
+	case uint64:
+		return strconv.FormatUint(value, 10) + "u", nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case string:
+		return `"` + stringEscaper.Replace(value) + `"`, nil
+	}
+	return "", fmt.Errorf("unsupported field type %T", v)
+}
@@ -0,0 +1,166 @@
+package influxdb
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPointEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		point Point
+		want  string
+	}{
+		{
+			name: "plain",
+			point: Point{
+				Measurement: "ups",
+				Tags:        []Tag{{Key: "device", Value: "rack"}},
+				Fields:      []Field{{Key: "value", Value: 1.5}},
+				Time:        10,
+			},
+			want: "ups,device=rack value=1.5 10\n",
+		},
+		{
+			name: "tags sorted and empty ones skipped",
+			point: Point{
+				Measurement: "ups",
+				Tags:        []Tag{{Key: "z", Value: "1"}, {Key: "a", Value: "2"}, {Key: "empty", Value: ""}, {Key: "", Value: "x"}},
+				Fields:      []Field{{Key: "value", Value: 1.0}},
+				Time:        10,
+			},
+			want: "ups,a=2,z=1 value=1 10\n",
+		},
+		{
+			name: "measurement with spaces and commas",
+			point: Point{
+				Measurement: "ups metrics,v2",
+				Fields:      []Field{{Key: "value", Value: 1.0}},
+				Time:        10,
+			},
+			want: `ups\ metrics\,v2 value=1 10` + "\n",
+		},
+		{
+			name: "measurement keeps equal signs",
+			point: Point{
+				Measurement: "a=b",
+				Fields:      []Field{{Key: "value", Value: 1.0}},
+				Time:        10,
+			},
+			want: "a=b value=1 10\n",
+		},
+		{
+			name: "tag keys and values with spaces, commas and equal signs",
+			point: Point{
+				Measurement: "ups",
+				Tags:        []Tag{{Key: "deploy name", Value: "rack a,b=c"}},
+				Fields:      []Field{{Key: "value", Value: 1.0}},
+				Time:        10,
+			},
+			want: `ups,deploy\ name=rack\ a\,b\=c value=1 10` + "\n",
+		},
+		{
+			name: "field keys with spaces, commas and equal signs",
+			point: Point{
+				Measurement: "ups",
+				Fields:      []Field{{Key: "a b,c=d", Value: 1.0}},
+				Time:        10,
+			},
+			want: `ups a\ b\,c\=d=1 10` + "\n",
+		},
+		{
+			name: "line breaks dropped from names and tags",
+			point: Point{
+				Measurement: "ups\n",
+				Tags:        []Tag{{Key: "dev\r\nice", Value: "ra\nck"}},
+				Fields:      []Field{{Key: "val\nue", Value: 1.0}},
+				Time:        10,
+			},
+			want: "ups,device=rack value=1 10\n",
+		},
+		{
+			name: "string fields with quotes and backslashes",
+			point: Point{
+				Measurement: "ups",
+				Fields:      []Field{{Key: "msg", Value: `say "hi" \ bye`}},
+				Time:        10,
+			},
+			want: `ups msg="say \"hi\" \\ bye" 10` + "\n",
+		},
+		{
+			name: "string fields keep spaces, commas and equal signs",
+			point: Point{
+				Measurement: "ups",
+				Fields:      []Field{{Key: "msg", Value: "a b,c=d"}},
+				Time:        10,
+			},
+			want: `ups msg="a b,c=d" 10` + "\n",
+		},
+		{
+			name: "tag values keep quotes and backslashes",
+			point: Point{
+				Measurement: "ups",
+				Tags:        []Tag{{Key: "name", Value: `"rack"\a`}},
+				Fields:      []Field{{Key: "value", Value: 1.0}},
+				Time:        10,
+			},
+			want: `ups,name="rack"\a value=1 10` + "\n",
+		},
+		{
+			name: "field types",
+			point: Point{
+				Measurement: "ups",
+				Fields: []Field{
+					{Key: "float", Value: 2.0},
+					{Key: "float32", Value: float32(0.5)},
+					{Key: "fraction", Value: 0.25},
+					{Key: "int", Value: 3},
+					{Key: "int64", Value: int64(-4)},
+					{Key: "uint", Value: uint64(5)},
+					{Key: "true", Value: true},
+					{Key: "false", Value: false},
+				},
+				Time: 10,
+			},
+			want: "ups float=2,float32=0.5,fraction=0.25,int=3i,int64=-4i,uint=5u,true=true,false=false 10\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := tt.point.Encode(&b)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		point Point
+	}{
+		{name: "no measurement", point: Point{Fields: []Field{{Key: "value", Value: 1.0}}}},
+		{name: "no fields", point: Point{Measurement: "ups"}},
+		{name: "NaN", point: Point{Measurement: "ups", Fields: []Field{{Key: "value", Value: math.NaN()}}}},
+		{name: "infinity", point: Point{Measurement: "ups", Fields: []Field{{Key: "value", Value: math.Inf(1)}}}},
+		{name: "unsupported type", point: Point{Measurement: "ups", Fields: []Field{{Key: "value", Value: []int{1}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := tt.point.Encode(&b)
+			if err == nil {
+				t.Fatalf("Encode() = %q, want an error", b.String())
+			}
+			if b.Len() != 0 {
+				t.Errorf("Encode() wrote %q on error", b.String())
+			}
+		})
+	}
+}
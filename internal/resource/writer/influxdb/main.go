@@ -1,14 +1,19 @@
 package influxdb
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/alexwbaule/ups-metrics/internal/application/config"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 	"github.com/alexwbaule/ups-metrics/internal/resource/http/client"
 	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"net/http"
 	"strings"
+	"time"
 )
 
 type Influx struct {
@@ -18,46 +23,94 @@ type Influx struct {
 }
 
 func NewWorker(l *logger.Logger, config *config.Config) writer.WriteMetric {
+	influx := config.GetMetricConfig().Influx
+
+	scheme := "http"
+	if influx.TLS {
+		scheme = "https"
+	}
 	return &Influx{
 		log:    l,
-		influx: config.GetMetricConfig().Influx,
-		client: client.New(config, fmt.Sprintf("http://%s:%s", config.GetMetricConfig().Influx.Address, config.GetMetricConfig().Influx.Port), l),
+		influx: influx,
+		client: client.New(config.GetHttpClient(), fmt.Sprintf("%s://%s:%s", scheme, influx.Address, influx.Port), l),
 	}
 }
 
-func (w *Influx) Write(ctx context.Context, metric device.Metric) error {
+func (w *Influx) Write(ctx context.Context, reading device.Reading) error {
 	var body strings.Builder
 	var response interface{}
 
-	request := client.Request{
-		Url:            "/write",
-		PathParameters: nil,
-		Headers:        nil,
-		QueryParameters: map[string]string{
-			"db": w.influx.Database,
-		},
+	ts := timestamp(reading.GetAt, w.influx.Precision)
+
+	tags := []Tag{
+		{Key: "device", Value: reading.Device},
+		{Key: "host", Value: reading.DeployName},
 	}
 
-	for _, gauge := range metric.Gauges {
-		if UPSMetricName(gauge.Name) != "" {
-			body.WriteString(fmt.Sprintf("%s,host=%s value=%s %d\n",
-				UPSMetricName(gauge.Name), metric.DeployName, gauge.Phases.Value, metric.GetAt.UnixNano()))
+	for _, q := range device.Quantities() {
+		m, ok := reading.Measurements[q]
+		if !ok {
+			continue
+		}
+		// gauges are always written as float so the field type never changes
+		fields := []Field{{Key: "value", Value: m.Value}}
+		if m.HasRange {
+			fields = append(fields, Field{Key: "min", Value: m.Min}, Field{Key: "max", Value: m.Max})
+		}
+		err := Point{
+			Measurement: string(q),
+			Tags:        tags,
+			Fields:      fields,
+			Time:        ts,
+		}.Encode(&body)
+		if err != nil {
+			return &writer.RejectedError{Err: err}
 		}
 	}
 
-	for _, state := range metric.States {
-		if UPSMetricState(state.Name) != "" {
-			body.WriteString(fmt.Sprintf("%s,host=%s value=\"%s\" %d\n",
-				UPSMetricState(state.Name), metric.DeployName, UPSMetricStateValue(state.Name, state.Value), metric.GetAt.UnixNano()))
+	for _, s := range device.Statuses() {
+		set, ok := reading.Statuses[s]
+		if !ok {
+			continue
+		}
+		measurement := stateMeasurements[s]
+		value := measurement.not
+		if set {
+			value = measurement.set
 		}
+		err := Point{
+			Measurement: measurement.name,
+			Tags:        tags,
+			Fields: []Field{
+				{Key: "value", Value: value},
+				{Key: "state", Value: set},
+			},
+			Time: ts,
+		}.Encode(&body)
+		if err != nil {
+			return &writer.RejectedError{Err: err}
+		}
+	}
+
+	request, err := w.request()
+	if err != nil {
+		return err
+	}
+	payload, err := w.payload(body.String())
+	if err != nil {
+		return err
 	}
 
-	get, err := w.client.Post(ctx, request, body.String(), &response)
+	get, err := w.client.Post(ctx, request, payload, &response)
 	if err != nil {
 		return err
 	}
 	if get.IsError() {
-		return fmt.Errorf("error: %s", get.String())
+		err = fmt.Errorf("error: %s", get.String())
+		if rejected(get.StatusCode()) {
+			return &writer.RejectedError{Err: err}
+		}
+		return err
 	}
 	if get.StatusCode() != 204 {
 		return fmt.Errorf("error: %s", get.String())
@@ -65,3 +118,99 @@ func (w *Influx) Write(ctx context.Context, metric device.Metric) error {
 	w.log.Infof("InfluxDB Write response: %d", get.StatusCode())
 	return nil
 }
+
+// rejected tells whether InfluxDB refused the points themselves, like a
+// malformed line or a field type conflict. Missing credentials, a missing
+// database and rate limits are fixed on the server, so those are retried.
+func rejected(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+		http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500
+}
+
+// request builds the write request for the configured API version. Version 1
+// uses /write with optional basic auth, 2 and 3 use the /api/v2/write endpoint
+// with token auth (InfluxDB 3 serves it for compatibility).
+func (w *Influx) request() (client.Request, error) {
+	headers := map[string]string{
+		"Content-Type": "text/plain; charset=utf-8",
+	}
+	if w.influx.Gzip {
+		headers["Content-Encoding"] = "gzip"
+	}
+
+	switch w.influx.Version {
+	case 1:
+		// the 1.x API spells microseconds u instead of us
+		precision := w.influx.Precision
+		if precision == "us" {
+			precision = "u"
+		}
+		query := map[string]string{
+			"db":        w.influx.Database,
+			"precision": precision,
+		}
+		if w.influx.RetentionPolicy != "" {
+			query["rp"] = w.influx.RetentionPolicy
+		}
+		if w.influx.Username != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(w.influx.Username + ":" + w.influx.Password))
+			headers["Authorization"] = "Basic " + auth
+		}
+		return client.Request{
+			Url:             "/write",
+			Headers:         headers,
+			QueryParameters: query,
+		}, nil
+	case 2, 3:
+		if w.influx.Token != "" {
+			headers["Authorization"] = "Token " + w.influx.Token
+		}
+		query := map[string]string{
+			"bucket":    w.influx.Bucket,
+			"precision": w.influx.Precision,
+		}
+		if w.influx.Org != "" {
+			query["org"] = w.influx.Org
+		}
+		return client.Request{
+			Url:             "/api/v2/write",
+			Headers:         headers,
+			QueryParameters: query,
+		}, nil
+	}
+	return client.Request{}, fmt.Errorf("unsupported influxdb version %d", w.influx.Version)
+}
+
+func (w *Influx) payload(body string) (any, error) {
+	if !w.influx.Gzip {
+		return body, nil
+	}
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func timestamp(t time.Time, precision string) int64 {
+	switch precision {
+	case "s":
+		return t.Unix()
+	case "ms":
+		return t.UnixMilli()
+	case "us":
+		return t.UnixMicro()
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,30 @@
+package influxdb
+
+import (
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"testing"
+)
+
+func TestRequestPrecision(t *testing.T) {
+	tests := []struct {
+		version   int
+		precision string
+		want      string
+	}{
+		{version: 1, precision: "ns", want: "ns"},
+		{version: 1, precision: "us", want: "u"},
+		{version: 1, precision: "ms", want: "ms"},
+		{version: 2, precision: "us", want: "us"},
+		{version: 3, precision: "s", want: "s"},
+	}
+	for _, tt := range tests {
+		w := &Influx{influx: device.Influx{Version: tt.version, Precision: tt.precision}}
+		request, err := w.request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := request.QueryParameters["precision"]; got != tt.want {
+			t.Errorf("version %d precision %s: sent %q, want %q", tt.version, tt.precision, got, tt.want)
+		}
+	}
+}
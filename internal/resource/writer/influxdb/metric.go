@@ -1,60 +1,22 @@
 package influxdb
 
-var UPSMetricName = func(code string) string {
-	status := map[string]string{
-		"Tensao de Entrada":   "input_voltage",
-		"Tensao de Saida":     "output_voltage",
-		"Nivel da Bateria":    "battery_level",
-		"Potencia de Saida":   "ups_load",
-		"Temperatura":         "ups_temperature",
-		"Frequencia de Saida": "output_frequency",
-	}
-	return status[code]
-}
-
-var UPSMetricState = func(code string) string {
-	status := map[string]string{
-		"Carga da Bateria": "battery_status",
-		"Nobreak":          "nobreak_status",
-		"Rede Eletrica":    "power_from",
-		"Teste":            "test",
-		"Boost":            "boost",
-		"ByPass":           "bypass",
-		"Potencia Elevada": "overload",
-	}
-	return status[code]
-}
+import "github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 
-var UPSMetricStateValue = func(code string, value bool) string {
-	status := map[string]map[bool]string{
-		"Carga da Bateria": {
-			true:  "ok",
-			false: "fail",
-		},
-		"Nobreak": {
-			true:  "fail",
-			false: "ok",
-		},
-		"Rede Eletrica": {
-			true:  "grid",
-			false: "battery",
-		},
-		"Teste": {
-			true:  "on",
-			false: "off",
-		},
-		"Boost": {
-			true:  "on",
-			false: "off",
-		},
-		"ByPass": {
-			true:  "on",
-			false: "off",
-		},
-		"Potencia Elevada": {
-			true:  "true",
-			false: "false",
-		},
-	}
-	return status[code][value]
+// stateMeasurements are the measurements of the statuses, each with the
+// text written for when the status is set and when it is not.
+var stateMeasurements = map[device.Status]struct {
+	name     string
+	set, not string
+}{
+	device.StatusInteractive: {name: "ups_type", set: "line_interactive", not: "standby"},
+	device.StatusBatteryFull: {name: "battery_status", set: "ok", not: "fail"},
+	device.StatusBatteryFail: {name: "nobreak_status", set: "fail", not: "ok"},
+	device.StatusOnGrid:      {name: "power_from", set: "grid", not: "battery"},
+	device.StatusTest:        {name: "test", set: "on", not: "off"},
+	device.StatusAlert24h:    {name: "alert_24h", set: "on", not: "off"},
+	device.StatusBoost:       {name: "boost", set: "on", not: "off"},
+	device.StatusBypass:      {name: "bypass", set: "on", not: "off"},
+	device.StatusHighPower:   {name: "overload", set: "true", not: "false"},
+	device.StatusWifi:        {name: "wifi", set: "true", not: "false"},
+	device.StatusRGB:         {name: "led_rgb", set: "true", not: "false"},
 }
@@ -0,0 +1,35 @@
+package latest
+
+import (
+	"context"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"sync"
+)
+
+// Store keeps the last reading of every device, for the servers that answer
+// with the current UPS readings.
+type Store struct {
+	mu   sync.RWMutex
+	last map[string]device.Reading
+}
+
+func NewStore() *Store {
+	return &Store{
+		last: make(map[string]device.Reading),
+	}
+}
+
+func (s *Store) Write(ctx context.Context, reading device.Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[reading.Device] = reading
+	return nil
+}
+
+// Get returns the last reading of the device, false when none was read yet.
+func (s *Store) Get(name string) (device.Reading, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reading, ok := s.last[name]
+	return reading, ok
+}
@@ -6,5 +6,20 @@ import (
 )
 
 type WriteMetric interface {
-	Write(ctx context.Context, metric device.Metric) error
+	Write(ctx context.Context, reading device.Reading) error
+}
+
+// RejectedError is a reading a sink refused, like a point InfluxDB could not
+// parse. Sending it again fails the same way, so it is never buffered or
+// retried.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
 }
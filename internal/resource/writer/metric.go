@@ -0,0 +1,12 @@
+package writer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var WriterResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ups",
+	Name:      "writer_writes_total",
+	Help:      "The write results of each metric sink",
+}, []string{"sink", "result"})
@@ -0,0 +1,167 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"strings"
+)
+
+// sensor is a Home Assistant MQTT discovery config, for both sensor and
+// binary_sensor components.
+type sensor struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	ObjectID          string   `json:"object_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	EntityCategory    string   `json:"entity_category,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	ExpireAfter       int      `json:"expire_after,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SwVersion    string   `json:"sw_version"`
+}
+
+// units maps the units of the quantities to the Home Assistant device class
+// and unit of measurement.
+var units = map[string]struct{ class, unit string }{
+	"V":  {class: "voltage", unit: "V"},
+	"Hz": {class: "frequency", unit: "Hz"},
+	"°C": {class: "temperature", unit: "°C"},
+	"%":  {unit: "%"},
+}
+
+// binaryClasses are the Home Assistant device classes of the statuses.
+var binaryClasses = map[device.Status]string{
+	device.StatusOnGrid:      "power",
+	device.StatusBatteryFail: "problem",
+	device.StatusHighPower:   "problem",
+	device.StatusAlert24h:    "problem",
+	device.StatusTest:        "running",
+}
+
+// diagnostics are entities describing the UPS rather than its readings.
+var diagnostics = map[string]bool{
+	string(device.StatusInteractive): true,
+	string(device.StatusWifi):        true,
+	string(device.StatusRGB):         true,
+}
+
+// discover publishes the discovery configs of the device, once per
+// connection.
+func (w *Mqtt) discover(ctx context.Context, reading device.Reading) error {
+	w.mu.Lock()
+	done := w.discovered[reading.Device]
+	w.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	node := objectID(reading.Device)
+	dev := haDevice{
+		Identifiers:  []string{"ups_metrics_" + node},
+		Name:         reading.Device,
+		Manufacturer: "SMS",
+		Model:        reading.UPSType,
+		SwVersion:    logger.Version,
+	}
+
+	for _, q := range device.Quantities() {
+		m, ok := reading.Measurements[q]
+		if !ok {
+			continue
+		}
+		name := string(q)
+		config := w.sensor(reading.Device, name, dev)
+		config.StateClass = "measurement"
+		if u, ok := units[m.Unit]; ok {
+			config.DeviceClass, config.Unit = u.class, u.unit
+		} else {
+			config.Unit = m.Unit
+		}
+		if q == device.QuantityBatteryLevel {
+			config.DeviceClass = "battery"
+		}
+		err := w.publishConfig(ctx, "sensor", node, name, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range device.Statuses() {
+		if _, ok := reading.Statuses[s]; !ok {
+			continue
+		}
+		name := string(s)
+		config := w.sensor(reading.Device, name, dev)
+		config.DeviceClass = binaryClasses[s]
+		config.PayloadOn, config.PayloadOff = onOff(true), onOff(false)
+
+		err := w.publishConfig(ctx, "binary_sensor", node, name, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	w.discovered[reading.Device] = true
+	w.mu.Unlock()
+	w.log.Infof("published Home Assistant discovery of %s", reading.Device)
+	return nil
+}
+
+func (w *Mqtt) sensor(name string, metric string, dev haDevice) sensor {
+	s := sensor{
+		Name:              strings.ReplaceAll(metric, "_", " "),
+		UniqueID:          dev.Identifiers[0] + "_" + metric,
+		ObjectID:          objectID(name) + "_" + metric,
+		StateTopic:        w.stateTopic(name, metric),
+		AvailabilityTopic: w.availabilityTopic(),
+		ExpireAfter:       int(w.mqtt.MaxAge.Seconds()),
+		Device:            dev,
+	}
+	if diagnostics[metric] {
+		s.EntityCategory = "diagnostic"
+	}
+	return s
+}
+
+func (w *Mqtt) publishConfig(ctx context.Context, component, node, metric string, config sensor) error {
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	topic := w.mqtt.DiscoveryPrefix + "/" + component + "/" + node + "/" + metric + "/config"
+	return w.publish(ctx, topic, payload)
+}
+
+// objectID converts a device name to the characters allowed in Home
+// Assistant ids.
+func objectID(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// topicLevel removes the MQTT wildcards and separators from a device name.
+func topicLevel(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
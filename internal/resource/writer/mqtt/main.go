@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/config"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	online  = "online"
+	offline = "offline"
+
+	disconnectQuiesce = 250 // milliseconds
+)
+
+// Mqtt publishes every gauge and state of the UPS as a retained message on its
+// own topic, "<topic_prefix>/<device>/<metric>". The availability topic is
+// set as last will, so subscribers know when ups-metrics is gone, and Home
+// Assistant discovery configs are published once per device and connection.
+type Mqtt struct {
+	log    *logger.Logger
+	mqtt   device.Mqtt
+	client paho.Client
+
+	mu         sync.Mutex
+	discovered map[string]bool
+}
+
+func NewWorker(l *logger.Logger, config *config.Config) writer.WriteMetric {
+	cfg := config.GetMetricConfig().Mqtt
+	w := &Mqtt{
+		log:        l,
+		mqtt:       cfg,
+		discovered: make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetWill(w.availabilityTopic(), offline, cfg.QoS, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(w.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			l.Warnf("MQTT connection lost: %s", err)
+		})
+	w.client = paho.NewClient(opts)
+
+	// connects in background, retrying until the broker is available
+	w.client.Connect()
+	return w
+}
+
+func (w *Mqtt) Write(ctx context.Context, reading device.Reading) error {
+	if !w.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to %s", w.mqtt.Broker)
+	}
+
+	if w.mqtt.Discovery {
+		err := w.discover(ctx, reading)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, q := range device.Quantities() {
+		m, ok := reading.Measurements[q]
+		if !ok {
+			continue
+		}
+		err := w.publish(ctx, w.stateTopic(reading.Device, string(q)), strconv.FormatFloat(m.Value, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range device.Statuses() {
+		set, ok := reading.Statuses[s]
+		if !ok {
+			continue
+		}
+		err := w.publish(ctx, w.stateTopic(reading.Device, string(s)), onOff(set))
+		if err != nil {
+			return err
+		}
+	}
+	w.log.Infof("published metric of %s to MQTT", reading.Device)
+	return nil
+}
+
+// Close marks ups-metrics as offline, as a clean disconnect does not send
+// the last will.
+func (w *Mqtt) Close() error {
+	defer w.client.Disconnect(disconnectQuiesce)
+
+	if !w.client.IsConnectionOpen() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return w.publish(ctx, w.availabilityTopic(), offline)
+}
+
+func (w *Mqtt) onConnect(client paho.Client) {
+	w.log.Infof("connected to MQTT broker %s", w.mqtt.Broker)
+
+	// the broker may have lost the retained configs, send them again
+	w.mu.Lock()
+	w.discovered = make(map[string]bool)
+	w.mu.Unlock()
+
+	token := client.Publish(w.availabilityTopic(), w.mqtt.QoS, true, online)
+	go func() {
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			w.log.Errorf("publishing MQTT availability: %s", token.Error())
+		}
+	}()
+}
+
+func (w *Mqtt) publish(ctx context.Context, topic string, payload any) error {
+	token := w.client.Publish(topic, w.mqtt.QoS, true, payload)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-token.Done():
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("publishing %s: %w", topic, token.Error())
+	}
+	return nil
+}
+
+func (w *Mqtt) availabilityTopic() string {
+	return w.mqtt.TopicPrefix + "/status"
+}
+
+func (w *Mqtt) stateTopic(name string, metric string) string {
+	return w.mqtt.TopicPrefix + "/" + topicLevel(name) + "/" + metric
+}
+
+func onOff(v bool) string {
+	if v {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,106 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alexwbaule/ups-metrics/internal/application/logger"
+	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
+	"golang.org/x/sync/errgroup"
+	"io"
+)
+
+const defaultQueueSize = 100
+
+// Multi dispatches every metric to all registered sinks. Each sink has its own
+// queue and worker, so a slow or failing sink never delays the others.
+type Multi struct {
+	log   *logger.Logger
+	sinks []*sink
+}
+
+type sink struct {
+	name   string
+	writer WriteMetric
+	queue  chan device.Reading
+}
+
+func NewMulti(l *logger.Logger) *Multi {
+	return &Multi{
+		log: l,
+	}
+}
+
+// Add registers a sink. It must be called before Run.
+func (m *Multi) Add(name string, w WriteMetric) {
+	m.sinks = append(m.sinks, &sink{
+		name:   name,
+		writer: w,
+		queue:  make(chan device.Reading, defaultQueueSize),
+	})
+}
+
+func (m *Multi) Len() int {
+	return len(m.sinks)
+}
+
+// Run starts one worker per sink and blocks until ctx is done. Sinks that are
+// an io.Closer are closed when their worker stops.
+func (m *Multi) Run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for _, s := range m.sinks {
+		s := s
+		g.Go(func() error {
+			m.worker(ctx, s)
+			return nil
+		})
+	}
+	err := g.Wait()
+	if err != nil {
+		return err
+	}
+	return context.Canceled
+}
+
+// Write queues the metric on every sink. It only fails when a sink queue is
+// full, in which case the metric is dropped for that sink alone.
+func (m *Multi) Write(ctx context.Context, reading device.Reading) error {
+	var errs []error
+
+	for _, s := range m.sinks {
+		select {
+		case s.queue <- reading:
+		default:
+			WriterResults.WithLabelValues(s.name, "dropped").Inc()
+			errs = append(errs, fmt.Errorf("%s queue is full, metric dropped", s.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Multi) worker(ctx context.Context, s *sink) {
+	log := m.log.With("sink", s.name)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("stopping writer job...")
+			if c, ok := s.writer.(io.Closer); ok {
+				err := c.Close()
+				if err != nil {
+					log.Errorf("closing writer error: %s", err)
+				}
+			}
+			return
+		case reading := <-s.queue:
+			err := s.writer.Write(ctx, reading)
+			if err != nil {
+				WriterResults.WithLabelValues(s.name, "failure").Inc()
+				log.Errorf("writing metric of %s error: %s", reading.Device, err)
+				continue
+			}
+			WriterResults.WithLabelValues(s.name, "success").Inc()
+		}
+	}
+}
@@ -2,49 +2,105 @@ package prometheus
 
 import (
 	"context"
-	"strconv"
-
 	"github.com/alexwbaule/ups-metrics/internal/application/config"
 	"github.com/alexwbaule/ups-metrics/internal/application/logger"
 	"github.com/alexwbaule/ups-metrics/internal/domain/entity/device"
 	"github.com/alexwbaule/ups-metrics/internal/resource/writer"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
 )
 
+// Prometheus keeps the last reading of every device and serves it on scrape.
+// Series of a device are dropped once its reading is older than MaxAge.
 type Prometheus struct {
 	log        *logger.Logger
 	prometheus device.Prometheus
+	mu         sync.RWMutex
+	last       map[string]device.Reading
 }
 
 func NewWorker(l *logger.Logger, config *config.Config) writer.WriteMetric {
-	return &Prometheus{
+	w := &Prometheus{
 		log:        l,
 		prometheus: config.GetMetricConfig().Prometheus,
+		last:       make(map[string]device.Reading),
+	}
+	// known devices are reported as down until their first reading arrives
+	for _, d := range config.GetDevices() {
+		w.last[d.Name] = device.Reading{Device: d.Name}
 	}
+	prometheus.MustRegister(w)
+	return w
+}
+
+func (w *Prometheus) Write(ctx context.Context, reading device.Reading) error {
+	w.log.Infof("caching metric of %s to prometheus", reading.Device)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last[reading.Device] = reading
+	return nil
 }
 
-func (w *Prometheus) Write(ctx context.Context, metric device.Metric) error {
-	w.log.Infof("sending metric to prometheus")
-
-	for _, gauge := range metric.Gauges {
-		if s, err := strconv.ParseFloat(gauge.Phases.Value, 64); err == nil {
-			UPSMetricName.WithLabelValues(metric.DeployName, UPSMetricStatusLabel(gauge.Name), gauge.Unit).Set(s)
-			w.log.Infof("adding phase %s (%s) == %f to gauge", gauge.Name, gauge.Phases.Value, s)
-		} else {
-			if gauge.Name == "Tipo" {
-				var value float64
-				if gauge.Phases.Value == "UPS Line Interative" {
-					value = 1
-				}
-				UPSMetricName.WithLabelValues(metric.DeployName, UPSMetricStatusLabel(gauge.Name), gauge.Unit).Set(value)
-				w.log.Infof("adding phase %s (%s) == %f to gauge", gauge.Name, gauge.Phases.Value, value)
-			}
+func (w *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	ch <- UPSMetricName
+	ch <- UPSMetricMin
+	ch <- UPSMetricMax
+	ch <- UPSMetricState
+	ch <- UPSUp
+	ch <- UPSLastSuccess
+}
+
+func (w *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	now := time.Now()
+	for name, reading := range w.last {
+		var up float64
+		fresh := !reading.GetAt.IsZero() && now.Sub(reading.GetAt) <= w.prometheus.MaxAge
+		if fresh {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(UPSUp, prometheus.GaugeValue, up, name)
+
+		if reading.GetAt.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(UPSLastSuccess, prometheus.GaugeValue, float64(reading.GetAt.UnixNano())/1e9, name)
+
+		if !fresh {
+			continue
+		}
+		w.collectReading(ch, reading)
+	}
+}
+
+func (w *Prometheus) collectReading(ch chan<- prometheus.Metric, reading device.Reading) {
+	for _, q := range device.Quantities() {
+		m, ok := reading.Measurements[q]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(UPSMetricName, prometheus.GaugeValue, m.Value, reading.Device, reading.DeployName, string(q), m.Unit)
+		if m.HasRange {
+			ch <- prometheus.MustNewConstMetric(UPSMetricMin, prometheus.GaugeValue, m.Min, reading.Device, reading.DeployName, string(q), m.Unit)
+			ch <- prometheus.MustNewConstMetric(UPSMetricMax, prometheus.GaugeValue, m.Max, reading.Device, reading.DeployName, string(q), m.Unit)
 		}
 	}
 
-	for _, state := range metric.States {
-		name, value := UPSMetricStateLabel(state.Name, state.Value)
-		UPSMetricState.WithLabelValues(metric.DeployName, name).Set(value)
-		w.log.Infof("adding state %s -> %s -> %f to gauge", state.Name, name, value)
+	values := reading.Values()
+	for _, s := range device.Statuses() {
+		value, ok := values[string(s)]
+		if !ok {
+			continue
+		}
+		if s == device.StatusInteractive {
+			// exported with the gauges, as the UPS sends it as one
+			ch <- prometheus.MustNewConstMetric(UPSMetricName, prometheus.GaugeValue, value, reading.Device, reading.DeployName, string(s), "")
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(UPSMetricState, prometheus.GaugeValue, value, reading.Device, reading.DeployName, string(s))
 	}
-	return nil
 }